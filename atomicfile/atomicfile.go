@@ -0,0 +1,71 @@
+// Package atomicfile writes files via a temporary file that is renamed over
+// the destination once complete, so readers never see a partial file.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// File is a temporary file that replaces its destination on Commit.
+type File struct {
+	*os.File
+	path string
+	done bool
+}
+
+// Create opens <path>.tmp for writing.
+func Create(path string) (*File, error) {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, path: path}, nil
+}
+
+// CreateIn opens a uniquely named temporary file for path in dir, or in the
+// directory of path when dir is empty. Commit renames it, so dir should be on
+// the same filesystem as path.
+func CreateIn(dir, path string) (*File, error) {
+	if len(dir) == 0 {
+		dir = filepath.Dir(path)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, path: path}, nil
+}
+
+// Commit syncs and closes the temporary file and renames it to the
+// destination. On failure the temporary file is removed.
+func (f *File) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Abort discards the temporary file, leaving the destination untouched. It
+// does nothing after Commit, so it can be deferred right after Create.
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,51 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		commit bool
+		want   string // content of the destination afterwards
+	}{
+		{name: "commit", commit: true, want: "new"},
+		{name: "abort", commit: false, want: "old"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out")
+			if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Abort()
+			if _, err := f.WriteString("new"); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != "old" {
+				t.Fatalf("destination changed before Commit: %q", got)
+			}
+
+			if tc.commit {
+				if err := f.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f.Abort()
+
+			if got, _ := os.ReadFile(path); string(got) != tc.want {
+				t.Errorf("destination = %q, want %q", got, tc.want)
+			}
+			if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Package compression detects the compression of zone files and creates the
+// writers for the supported output formats.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Output formats accepted by NewWriter.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+	None = "none"
+)
+
+// Bzip2 is detected and decompressed on input but cannot be written.
+const Bzip2 = "bzip2"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd} // 0xFD2FB528, little-endian
+)
+
+// Detect returns the compression of the data in r from its magic bytes:
+// Gzip, Zstd, Bzip2 or None. It consumes up to four bytes of r.
+func Detect(r io.Reader) (string, error) {
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return formatOf(magic[:n]), nil
+}
+
+func formatOf(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return Gzip
+	case bytes.Equal(magic, zstdMagic):
+		return Zstd
+	case len(magic) == 4 && bytes.HasPrefix(magic, []byte("BZh")) && magic[3] >= '1' && magic[3] <= '9':
+		return Bzip2
+	}
+	return None
+}
+
+// Peek returns the compression of the data buffered in br, like Detect,
+// without consuming it.
+func Peek(br *bufio.Reader) (string, error) {
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return formatOf(magic), nil
+}
+
+// Open returns a reader for r, decompressing it when its magic bytes mark
+// it as gzip, zstd or bzip2 and reading it as plain text otherwise. Closing
+// the returned reader does not close r.
+func Open(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	format, err := Peek(br)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case Gzip:
+		return gzip.NewReader(br)
+	case Zstd:
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// Valid reports whether format is a supported output format.
+func Valid(format string) bool {
+	switch format {
+	case Gzip, Zstd, None:
+		return true
+	}
+	return false
+}
+
+// Extension returns the file extension for format: ".gz", ".zst" or ".txt".
+func Extension(format string) string {
+	switch format {
+	case Zstd:
+		return ".zst"
+	case None:
+		return ".txt"
+	}
+	return ".gz"
+}
+
+// TrimExtension strips a compressed-file extension (".gz", ".zst") from name.
+func TrimExtension(name string) string {
+	for _, ext := range []string{".gz", ".zst"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewWriter wraps w in an encoder for format. An empty format means gzip.
+// Closing the returned writer flushes the encoder but does not close w.
+func NewWriter(w io.Writer, format string) (io.WriteCloser, error) {
+	switch format {
+	case Gzip, "":
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case None:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unknown compression '%s'", format)
+}
@@ -0,0 +1,87 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		data   string
+		format string
+	}{
+		{data: "\x1f\x8b\x08\x00", format: Gzip},
+		{data: "\x28\xb5\x2f\xfd\x00", format: Zstd},
+		{data: "\x28\xb5\x2f", format: None},
+		{data: "BZh91AY&SY", format: Bzip2},
+		{data: "BZh0", format: None},
+		{data: "example. IN A 192.0.2.1\n", format: None},
+		{data: "", format: None},
+	} {
+		if format, err := Detect(strings.NewReader(tc.data)); err != nil || format != tc.format {
+			t.Errorf("Detect(%q) = %q, %v; want %q", tc.data, format, err, tc.format)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	const text = "a.example\nb.example\n"
+	for _, format := range []string{Gzip, Zstd, None, ""} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format)
+		if err != nil {
+			t.Fatalf("%q: %s", format, err)
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := Open(&buf)
+		if err != nil {
+			t.Fatalf("%q: %s", format, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != text {
+			t.Errorf("%q: read back %q, %v", format, got, err)
+		}
+	}
+
+	if _, err := NewWriter(io.Discard, "lz4"); err == nil {
+		t.Error("NewWriter accepted an unknown format")
+	}
+}
+
+func TestNames(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		valid  bool
+		ext    string
+	}{
+		{format: Gzip, valid: true, ext: ".gz"},
+		{format: Zstd, valid: true, ext: ".zst"},
+		{format: None, valid: true, ext: ".txt"},
+		{format: "lz4", ext: ".gz"},
+	} {
+		if Valid(tc.format) != tc.valid || Extension(tc.format) != tc.ext {
+			t.Errorf("%q: Valid %t, Extension %q", tc.format, Valid(tc.format), Extension(tc.format))
+		}
+	}
+
+	for name, want := range map[string]string{
+		"com.zone.gz":  "com.zone",
+		"org.txt.zst":  "org.txt",
+		"net.txt":      "net.txt",
+		"gz":           "gz",
+		"a.gz.tar.zst": "a.gz.tar",
+	} {
+		if got := TrimExtension(name); got != want {
+			t.Errorf("TrimExtension(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
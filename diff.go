@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zf-analysis/atomicfile"
+	"zf-analysis/compression"
+)
+
+// diffZones compares the output of every processed zone with the file of the
+// same name in -diff, writing <output>_diff_added and _diff_removed files.
+func diffZones() {
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	for _, zone := range zones {
+		if len(zone.OutputFile) == 0 {
+			continue
+		}
+		previous := filepath.Join(*diffDir, filepath.Base(zone.OutputFile))
+		if _, err := os.Stat(previous); err != nil {
+			v("no previous output for %s; not diffing", zone.OutputFile)
+			continue
+		}
+
+		ext := compression.Extension(*outputCompression)
+		base := strings.TrimSuffix(zone.OutputFile, ext)
+		err := diffDomains(previous, zone.OutputFile, base+"_diff_added"+ext, base+"_diff_removed"+ext)
+		if err != nil {
+			log.Printf("ERR: diff of %s: %s", zone.OutputFile, err)
+		}
+	}
+}
+
+// sortedLines reads a sorted domain list line by line and fails on lines
+// that are out of order.
+type sortedLines struct {
+	path    string
+	scanner *bufio.Scanner
+	line    string
+	ok      bool
+	err     error
+}
+
+func (s *sortedLines) next() {
+	prev := s.line
+	if s.ok = s.scanner.Scan(); !s.ok {
+		s.err = s.scanner.Err()
+		return
+	}
+	s.line = s.scanner.Text()
+	if s.line < prev {
+		s.ok = false
+		s.err = fmt.Errorf("%s is not sorted at '%s'", s.path, s.line)
+	}
+}
+
+// diffDomains merge-joins the sorted domain lists oldPath and newPath,
+// writing the domains only in newPath to addedPath and those only in
+// oldPath to removedPath. Neither list is held in memory.
+func diffDomains(oldPath, newPath, addedPath, removedPath string) error {
+	var lists [2]*sortedLines
+	for i, path := range []string{oldPath, newPath} {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, err := compression.Open(f)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		lists[i] = &sortedLines{path: path, scanner: bufio.NewScanner(r)}
+		lists[i].next()
+	}
+	old, cur := lists[0], lists[1]
+
+	var outputs [2]*atomicfile.File
+	var writers [2]io.WriteCloser
+	for i, path := range []string{addedPath, removedPath} {
+		f, err := atomicfile.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Abort()
+		outputs[i] = f
+		if writers[i], err = compression.NewWriter(f, *outputCompression); err != nil {
+			return err
+		}
+	}
+	added, removed := writers[0], writers[1]
+
+	var err error
+	for err == nil && old.err == nil && cur.err == nil && (old.ok || cur.ok) {
+		switch {
+		case !old.ok || (cur.ok && cur.line < old.line):
+			_, err = added.Write([]byte(cur.line + "\n"))
+			cur.next()
+		case !cur.ok || old.line < cur.line:
+			_, err = removed.Write([]byte(old.line + "\n"))
+			old.next()
+		default:
+			old.next()
+			cur.next()
+		}
+	}
+	for _, e := range []error{err, old.err, cur.err} {
+		if e != nil {
+			return e
+		}
+	}
+
+	for i := range writers {
+		if err := writers[i].Close(); err != nil {
+			return err
+		}
+		if err := outputs[i].Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
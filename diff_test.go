@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zf-analysis/zoneparse/comparse"
+)
+
+func TestDiffDomains(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, cur string
+		added    string
+		removed  string
+		wantErr  bool
+	}{
+		{name: "changes", old: "a\nb\nd\n", cur: "b\nc\nd\ne\n", added: "c\ne\n", removed: "a\n"},
+		{name: "same", old: "a\nb\n", cur: "a\nb\n"},
+		{name: "from empty", cur: "a\nb\n", added: "a\nb\n"},
+		{name: "to empty", old: "a\nb\n", removed: "a\nb\n"},
+		{name: "unsorted", old: "a\nb\n", cur: "b\na\n", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldPath, curPath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+			os.WriteFile(oldPath, []byte(tc.old), 0644)
+			os.WriteFile(curPath, gzipBytes(tc.cur), 0644)
+			added, removed := filepath.Join(dir, "added.gz"), filepath.Join(dir, "removed.gz")
+
+			err := diffDomains(oldPath, curPath, added, removed)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("no error for an unsorted list")
+				}
+				if _, err := os.Stat(added); err == nil {
+					t.Error("output written for an unsorted list")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readOutput(t, added); got != tc.added {
+				t.Errorf("added %q, want %q", got, tc.added)
+			}
+			if got := readOutput(t, removed); got != tc.removed {
+				t.Errorf("removed %q, want %q", got, tc.removed)
+			}
+		})
+	}
+}
+
+func TestDiffComparseOutput(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, zone := range []string{
+		"ab NS x\na NS x\nb NS x\n",
+		"a-b NS x\nab NS x\na NS x\nb0 NS x\n",
+	} {
+		path := filepath.Join(dir, []string{"old.gz", "new.gz"}[i])
+		if _, _, _, err := comparse.ParseFile(strings.NewReader(zone), path, comparse.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	added, removed := filepath.Join(dir, "added.gz"), filepath.Join(dir, "removed.gz")
+	if err := diffDomains(paths[0], paths[1], added, removed); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readOutput(t, added), "a-b.com\nb0.com\n"; got != want {
+		t.Errorf("added %q, want %q", got, want)
+	}
+	if got, want := readOutput(t, removed), "b.com\n"; got != want {
+		t.Errorf("removed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// levelFatal is the slog level of fatal errors, reported as "FATAL".
+const levelFatal = slog.Level(12)
+
+var (
+	jsonLogs bool
+
+	logFile   *os.File
+	logBuffer *bufio.Writer
+)
+
+// setupLogging directs log output to the file path, appending to it, or to
+// stderr when path is empty, and switches to one JSON object per line when
+// format is "json". Plain log.Printf calls are routed through slog as well.
+func setupLogging(format, path string) error {
+	var out io.Writer = os.Stderr
+	if len(path) != 0 {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		logFile = f
+		logBuffer = bufio.NewWriter(f)
+		out = logBuffer
+		log.SetOutput(out)
+	}
+
+	if format != "json" {
+		return nil
+	}
+	jsonLogs = true
+
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case slog.TimeKey:
+				a.Key = "ts"
+			case slog.LevelKey:
+				if level, ok := a.Value.Any().(slog.Level); ok && level == levelFatal {
+					a.Value = slog.StringValue("FATAL")
+				}
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// closeLog flushes and closes the -log-file, if any. Call it before exiting.
+func closeLog() {
+	if logFile == nil {
+		return
+	}
+	logBuffer.Flush()
+	logFile.Sync()
+	logFile.Close()
+	logFile = nil
+}
+
+// fatal is log.Fatal, logged at level FATAL with -log-format=json.
+func fatal(v ...interface{}) {
+	msg := fmt.Sprint(v...)
+	if jsonLogs {
+		slog.Log(context.Background(), levelFatal, msg)
+	} else {
+		log.Output(2, msg)
+	}
+	closeLog()
+	os.Exit(1)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupLoggingJSON(t *testing.T) {
+	defaultLogger, stderr := slog.Default(), os.Stderr
+	defer func() {
+		slog.SetDefault(defaultLogger)
+		os.Stderr = stderr
+		jsonLogs = false
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	os.Stderr = w
+	if err := setupLogging("json", ""); err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = stderr
+	slog.Info("Processing zone", "file", "net.txt.gz")
+	w.Close()
+
+	line, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(line, &entry); err != nil || entry["ts"] == nil || entry["level"] != "INFO" ||
+		entry["msg"] != "Processing zone" || entry["file"] != "net.txt.gz" {
+		t.Errorf("log line %s: %v", line, err)
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	defaultLogger, flags := slog.Default(), log.Flags()
+	defer func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		jsonLogs = false
+	}()
+
+	for _, tc := range []struct {
+		format string
+		check  func(t *testing.T, line string)
+	}{
+		{format: "json", check: func(t *testing.T, line string) {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil || entry["ts"] == nil || entry["level"] != "INFO" || entry["msg"] == nil {
+				t.Errorf("log line %s: %v", line, err)
+			}
+		}},
+		{format: "text", check: func(t *testing.T, line string) {
+			if !strings.Contains(line, "Processing zone") && !strings.Contains(line, "hello 1") {
+				t.Errorf("log line %s", line)
+			}
+		}},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			slog.SetDefault(defaultLogger)
+			jsonLogs = false
+			path := filepath.Join(t.TempDir(), "log")
+			if err := setupLogging(tc.format, path); err != nil {
+				t.Fatal(err)
+			}
+			slog.Info("Processing zone", "file", "net.txt.gz")
+			log.Printf("hello %d", 1)
+			closeLog()
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			lines := 0
+			for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+				tc.check(t, scanner.Text())
+			}
+			if lines != 2 {
+				t.Errorf("got %d log lines, want 2", lines)
+			}
+		})
+	}
+}
+
+func TestProcessZoneLog(t *testing.T) {
+	defaultLogger, flags := slog.Default(), log.Flags()
+	defer func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		jsonLogs = false
+	}()
+
+	path := filepath.Join(t.TempDir(), "missing.txt.gz")
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{format: "text", want: "Processing zone " + path + "\n"},
+		{format: "json", want: `"msg":"Processing zone","file":"` + path + `"`},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			slog.SetDefault(defaultLogger)
+			jsonLogs = false
+			logPath := filepath.Join(t.TempDir(), "log")
+			if err := setupLogging(tc.format, logPath); err != nil {
+				t.Fatal(err)
+			}
+			log.SetFlags(0)
+			processZone(context.Background(), nil, ZoneFile{Path: path})
+			closeLog()
+
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tc.want) {
+				t.Errorf("log %q lacks %q", data, tc.want)
+			}
+		})
+	}
+}
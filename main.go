@@ -1,37 +1,243 @@
 package main
 
 import (
-	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cheggaaa/pb"
+	"golang.org/x/net/idna"
+	"zf-analysis/atomicfile"
+	"zf-analysis/compression"
+	"zf-analysis/workerpool"
 	"zf-analysis/zoneparse"
 	"zf-analysis/zoneparse/comparse"
 )
 
 var (
-	loadDone  = make(chan bool)
-	inputChan = make(chan string)
-	work      sync.WaitGroup
-	zones     []ZoneInfo
-
-	directory = flag.String("directory", "", "directory with zone files")
-	verbose   = flag.Bool("verbose", false, "enable verbose logging")
-	pbar      = flag.Bool("progress", false, "enable progress bar")
-	parallel  = flag.Uint("parallel", 2, "number of zones to process in parallel")
+	zones       []ZoneInfo
+	failedZones []string // "<path>: <error>" of the zones that could not be processed
+	zonesMu     sync.Mutex
+
+	directory         = flag.String("directory", "", "directory with zone files")
+	sampleRate        = flag.Float64("sample-rate", 1, "only output this fraction (0-1] of domains, chosen deterministically by a hash of the name")
+	minLabels         = flag.Int("min-labels", 0, "only output domains with at least this many labels, e.g. 2 for example.com (default no limit)")
+	maxLabels         = flag.Int("max-labels", 0, "only output domains with at most this many labels (default no limit)")
+	maxDomains        = flag.Uint("max-domains", 0, "only output the first this many unique domains of each zone (default all)")
+	validateOnly      = flag.Bool("validate-only", false, "only check zone files for parse errors; report them on stdout and write no files")
+	metricsAddr       = flag.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+	logFilePath       = flag.String("log-file", "", "append log output to this file instead of stderr")
+	logFormat         = flag.String("log-format", "text", "log output format: text or json")
+	verbose           = flag.Bool("verbose", false, "enable verbose logging")
+	pbar              = flag.Bool("progress", false, "enable progress bar")
+	parallel          = flag.Uint("parallel", 2, "number of zones to process in parallel")
+	includeMX         = flag.Bool("include-mx", false, "list the top mail servers of each zone in the stats file")
+	includeNS         = flag.Bool("include-ns", false, "list the nameservers of each zone's apex in the stats file")
+	includeSRV        = flag.Bool("include-srv", false, "list the SRV service types of each zone in the stats file")
+	filterType        = flag.String("filter-type", "", "comma-separated record types whose owner names are output, or ALL (default all)")
+	sldOnly           = flag.Bool("sld-only", false, "reduce names to the domain directly below the zone apex, e.g. ns1.example.com to example.com")
+	skipWildcards     = flag.Bool("skip-wildcards", false, "do not output wildcard owner names such as *.example (default output their parent, example)")
+	skipDNSSEC        = flag.Bool("skip-dnssec", false, "do not output owner names of DNSSEC records (DNSKEY, RRSIG, NSEC, NSEC3, DS, ...)")
+	filterDomain      = flag.String("filter-domain", "", "only output domains matching this glob, or regular expression when prefixed with re:")
+	domainStats       = flag.Bool("domain-stats", false, "add a histogram of domain name lengths to the stats file")
+	ttlStats          = flag.Bool("ttl-stats", false, "add the TTL range, median and a histogram of TTLs to the stats file")
+	typeStats         = flag.Bool("type-stats", false, "count the records of each type per zone in the stats file")
+	statsFormat       = flag.String("stats-format", "text", "format of the stats file: text, json or csv")
+	idnaDecode        = flag.Bool("idna-decode", false, "write internationalized (xn--) labels in their Unicode form")
+	specialZones      = flag.String("special-zones", "com.zone.gz,org.zone.gz", "comma-separated file names of zones too large for the generic parser, parsed with the NS/A-only com zone parser")
+	inputPattern      = flag.String("input-pattern", "*.txt.gz", "glob of zone files to process in directory; gzipped or plain text")
+	outputCompression = flag.String("output-compression", compression.Gzip, "compression of output files: gzip, zstd or none")
+	outputDir         = flag.String("output-dir", "", "directory for output files (default the input directory)")
+	shardCount        = flag.Int("shard-count", 1, "split the output of each -special-zones file over this many files named <output>_shard_N, by a hash of the domain")
+	aggregateOutput   = flag.String("aggregate-output", "", "also merge the domains of all zones into this file, sorted and deduplicated")
+	previousStats     = flag.String("previous-stats", "", "stats file of a previous run; list the zones whose serial changed, stayed the same, were added or were dropped since then")
+	diffDir           = flag.String("diff", "", "directory with the output of a previous run; write the domains added and removed since then per zone")
+	timeout           = flag.Duration("timeout", 0, "stop processing after this long, e.g. 30m (default no limit)")
+	httpTimeout       = flag.Duration("http-timeout", 30*time.Second, "how long to wait for the response to a zone file URL")
+	httpRetries       = flag.Uint("http-retries", 3, "number of times to retry a failed zone file download")
+
+	filterTypes  zoneparse.RecordTypeSet
+	domainFilter func(domain string) bool
 )
 
+// cancelCheckInterval is how many records makeDomainsFile scans between
+// checks for cancellation.
+const cancelCheckInterval = 4096
+
+// shutdownTimeout is how long an interrupted run waits for in-flight zones
+// before writing the stats file.
+const shutdownTimeout = 10 * time.Second
+
+// exitInterrupted is the exit code of a run stopped by SIGINT or SIGTERM.
+const exitInterrupted = 2
+
+// maxReportedErrors is the number of parse errors listed per zone with
+// -validate-only.
+const maxReportedErrors = 10
+
+// exitInvalid is the exit code of a -validate-only run that found errors,
+// could not read a zone or was stopped early.
+const exitInvalid = 1
+
+// maxMailServers is the number of mail servers listed per zone with -include-mx.
+const maxMailServers = 10
+
+// MXSummary describes one mail server of a zone.
+type MXSummary struct {
+	Exchange string `json:"exchange"`
+	Priority uint16 `json:"priority"` // lowest preference of the MX records naming Exchange
+}
+
 type ZoneInfo struct {
-	SOA   string
-	Count uint
+	OutputFile   string          `json:"output_file"`
+	ShardFiles   []string        `json:"shard_files,omitempty"` // output of a -special-zones file with -shard-count; OutputFile is empty then
+	SOA          string          `json:"soa"`
+	SerialNumber uint32          `json:"serial"`
+	Count        uint            `json:"count"`
+	MailServers  []MXSummary     `json:"mail_servers,omitempty"` // by priority, then exchange
+	Nameservers  []string        `json:"nameservers,omitempty"`  // NS targets of the apex, sorted
+	SRVServices  map[string]uint `json:"srv_services,omitempty"` // SRV service, e.g. "_sip._tcp" -> number of SRV records
+
+	RecordTypeCounts map[zoneparse.RecordType]uint `json:"record_type_counts,omitempty"`
+	DNSSECAlgorithms map[uint8]uint                `json:"dnssec_algorithms,omitempty"` // DNSKEY algorithm -> number of DNSKEY records
+	ParseErrors      []string                      `json:"parse_errors,omitempty"`      // lines the scanner could not parse, up to maxParseErrors; they are skipped
+	ParseErrorCount  uint                          `json:"parse_error_count,omitempty"` // all parse errors, including those not in ParseErrors
+
+	LabelDepthHistogram   map[int]uint `json:"label_depth_histogram,omitempty"`   // number of labels -> number of domains
+	DomainLengthHistogram map[int]uint `json:"domain_length_histogram,omitempty"` // length without TLD -> number of domains
+
+	ParseDuration time.Duration `json:"parse_duration_ns"`
+	BytesRead     int64         `json:"bytes_read"` // uncompressed bytes of zone data read
+
+	Truncated  bool    `json:"truncated,omitempty"`   // output was cut at -max-domains
+	SampleRate float64 `json:"sample_rate,omitempty"` // fraction of domains output with -sample-rate; 0 when all
+
+	WildcardCount uint `json:"wildcard_count,omitempty"` // records with a wildcard owner such as *.example
+
+	TTLHistogram map[int64]uint `json:"ttl_histogram,omitempty"` // lower bound of TTL bucket -> number of records
+	MinTTL       *int64         `json:"min_ttl,omitempty"`       // pointers so that a TTL of 0 is still written
+	MaxTTL       *int64         `json:"max_ttl,omitempty"`
+	MedianTTL    *int64         `json:"median_ttl,omitempty"`
+}
+
+// ThroughputMBps returns how many MB of uncompressed zone data were parsed
+// per second, or 0 when BytesRead is unknown.
+func (zone ZoneInfo) ThroughputMBps() float64 {
+	if zone.BytesRead == 0 || zone.ParseDuration <= 0 {
+		return 0
+	}
+	return float64(zone.BytesRead) / 1e6 / zone.ParseDuration.Seconds()
+}
+
+// Stats returns the zone's entry in the stats file.
+func (zone ZoneInfo) Stats() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SOA: %20s\tSerial: %10d\tNum.Domains: %d\tTime: %s\tMB/s: %.1f\n",
+		zone.SOA,
+		zone.SerialNumber,
+		zone.Count,
+		zone.ParseDuration.Round(time.Millisecond),
+		zone.ThroughputMBps(),
+	)
+	if zone.Truncated {
+		fmt.Fprintf(&b, "\tTruncated at %d domains\n", zone.Count)
+	}
+	if zone.SampleRate > 0 {
+		fmt.Fprintf(&b, "\tSample rate: %g\n", zone.SampleRate)
+	}
+	if zone.WildcardCount > 0 {
+		fmt.Fprintf(&b, "\tWildcard records: %d\n", zone.WildcardCount)
+	}
+	if len(zone.MailServers) > 0 {
+		var servers []string
+		for i, mx := range zone.MailServers {
+			if i == maxMailServers {
+				break
+			}
+			servers = append(servers, fmt.Sprintf("%d %s", mx.Priority, mx.Exchange))
+		}
+		fmt.Fprintf(&b, "\tMX: %s\n", strings.Join(servers, ", "))
+	}
+	if len(zone.Nameservers) > 0 {
+		fmt.Fprintf(&b, "\tNS: %s\n", strings.Join(zone.Nameservers, ", "))
+	}
+	if len(zone.SRVServices) > 0 {
+		fmt.Fprintf(&b, "\tSRV: %s\n", strings.Join(topCounts(zone.SRVServices, len(zone.SRVServices)), ", "))
+	}
+	if (*verbose || *validateOnly) && zone.ParseErrorCount > 0 {
+		fmt.Fprintf(&b, "\tParse errors: %d\n", zone.ParseErrorCount)
+	}
+	if *validateOnly {
+		for i, msg := range zone.ParseErrors {
+			if i == maxReportedErrors {
+				break
+			}
+			fmt.Fprintf(&b, "\t\t%s\n", msg)
+		}
+	}
+	if *verbose {
+		depths := make([]int, 0, len(zone.LabelDepthHistogram))
+		for depth := range zone.LabelDepthHistogram {
+			depths = append(depths, depth)
+		}
+		sort.Ints(depths)
+		for _, depth := range depths {
+			fmt.Fprintf(&b, "\tLabelDepth[%d]: %d\n", depth, zone.LabelDepthHistogram[depth])
+		}
+	}
+	lengths := make([]int, 0, len(zone.DomainLengthHistogram))
+	for length := range zone.DomainLengthHistogram {
+		lengths = append(lengths, length)
+	}
+	sort.Ints(lengths)
+	for _, length := range lengths {
+		fmt.Fprintf(&b, "\tDomainLen[%d]: %d\n", length, zone.DomainLengthHistogram[length])
+	}
+	if len(zone.TTLHistogram) > 0 {
+		fmt.Fprintf(&b, "\tTTL: min %d, median %d, max %d\n", *zone.MinTTL, *zone.MedianTTL, *zone.MaxTTL)
+		for i, low := range ttlBuckets {
+			if i+1 < len(ttlBuckets) {
+				fmt.Fprintf(&b, "\tTTL[%d-%d]: %d\n", low, ttlBuckets[i+1]-1, zone.TTLHistogram[low])
+			} else {
+				fmt.Fprintf(&b, "\tTTL[%d-]: %d\n", low, zone.TTLHistogram[low])
+			}
+		}
+	}
+	algorithms := make([]int, 0, len(zone.DNSSECAlgorithms))
+	for alg := range zone.DNSSECAlgorithms {
+		algorithms = append(algorithms, int(alg))
+	}
+	sort.Ints(algorithms)
+	for _, alg := range algorithms {
+		fmt.Fprintf(&b, "\tDNSKEY-Alg[%d]: %d (%s)\n", alg, zone.DNSSECAlgorithms[uint8(alg)], zoneparse.AlgorithmName(uint8(alg)))
+	}
+	types := make([]zoneparse.RecordType, 0, len(zone.RecordTypeCounts))
+	for rt := range zone.RecordTypeCounts {
+		types = append(types, rt)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, rt := range types {
+		fmt.Fprintf(&b, "\tType%s: %d\n", rt, zone.RecordTypeCounts[rt])
+	}
+	return b.String()
 }
 
 func v(format string, v ...interface{}) {
@@ -42,150 +248,604 @@ func v(format string, v ...interface{}) {
 
 func checkFlags() {
 	flag.Parse()
-	if len(*directory) == 0 {
-		log.Printf("must pass directory (e.g. /data/domains/2019/02/01/)")
+	if err := setupLogging(*logFormat, *logFilePath); err != nil {
+		log.Printf("cannot open log-file: %s", err)
+		goto FlagError
+	}
+	if len(*directory) == 0 && flag.NArg() == 0 {
+		log.Printf("must pass directory (e.g. /data/domains/2019/02/01/) or zone files")
 		goto FlagError
 	}
 	if *parallel < 1 {
 		log.Printf("parallel must be positive")
 		goto FlagError
 	}
+	if len(*filterType) > 0 && !strings.EqualFold(*filterType, "ALL") {
+		set, err := zoneparse.LookupTableFromTypes(strings.Split(*filterType, ","))
+		if err != nil {
+			log.Printf("invalid filter-type: %s", err)
+			goto FlagError
+		}
+		filterTypes = set
+	}
+	if len(*filterDomain) > 0 {
+		filter, err := newDomainFilter(*filterDomain)
+		if err != nil {
+			log.Printf("invalid filter-domain: %s", err)
+			goto FlagError
+		}
+		domainFilter = filter
+	}
+	if *minLabels < 0 || *maxLabels < 0 || (*maxLabels > 0 && *maxLabels < *minLabels) {
+		log.Printf("min-labels and max-labels must be non-negative, with max-labels at least min-labels")
+		goto FlagError
+	}
+	if !(*sampleRate > 0 && *sampleRate <= 1) {
+		log.Printf("sample-rate must be in (0, 1]")
+		goto FlagError
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		log.Printf("log-format must be text or json")
+		goto FlagError
+	}
+	switch *statsFormat {
+	case "text", "json", "csv":
+	default:
+		log.Printf("stats-format must be text, json or csv")
+		goto FlagError
+	}
+	if !compression.Valid(*outputCompression) {
+		log.Printf("output-compression must be gzip, zstd or none")
+		goto FlagError
+	}
+	if *shardCount < 1 {
+		log.Printf("shard-count must be at least 1")
+		goto FlagError
+	}
+	if len(*outputDir) != 0 && !*validateOnly {
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			log.Printf("cannot create output-dir: %s", err)
+			goto FlagError
+		}
+	}
+	if len(*previousStats) != 0 {
+		// read before this run's stats file may replace it
+		serials, err := readStatsSerials(*previousStats)
+		if err != nil {
+			log.Printf("cannot read previous-stats: %s", err)
+			goto FlagError
+		}
+		previousSerials = serials
+	}
+	httpClient = newHTTPClient(*httpTimeout)
 	return
 
 FlagError:
+	closeLog()
 	flag.PrintDefaults()
 	os.Exit(1)
 }
 
-func loadFilesToProcess(files []string) {
-	for _, file := range files {
-		work.Add(1)
-		inputChan <- file
+// processZone runs makeDomainsFile for file unless the run was cancelled.
+func processZone(ctx context.Context, bar *pb.ProgressBar, file ZoneFile) {
+	if ctx.Err() != nil {
+		return
+	}
+	if *pbar {
+		bar.Increment()
+	} else if jsonLogs {
+		slog.Info("Processing zone", "file", file.Path)
+	} else {
+		log.Printf("Processing zone %s", file.Path)
+	}
+	if err := makeDomainsFile(ctx, file); err != nil {
+		log.Printf("ERR: %s: %s", file.Path, err)
+		zonesMu.Lock()
+		failedZones = append(failedZones, fmt.Sprintf("%s: %s", file.Path, err))
+		zonesMu.Unlock()
+		metrics.zoneFailed()
 	}
-	loadDone <- true
 }
 
-func worker(bar *pb.ProgressBar) {
-	for {
-		file, more := <-inputChan
-		if more {
-			if *pbar {
-				bar.Increment()
-			} else {
-				log.Printf("Processing zone %s", file)
-			}
-			makeDomainsFile(file)
-			work.Done()
-		} else {
-			// done
-			return
+// validationFailed reports whether a -validate-only run found parse errors
+// or zones that could not be read.
+func validationFailed() bool {
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	if len(failedZones) != 0 {
+		return true
+	}
+	for _, zone := range zones {
+		if zone.ParseErrorCount != 0 {
+			return true
 		}
 	}
+	return false
 }
 
-func makeDomainsFile(zonefile string) {
-	// Special case com.zone file
-	if strings.Contains(zonefile, "com.zone.gz") {
-		soa, count := comparse.Parse(zonefile)
-		zones = append(zones, ZoneInfo{
-			SOA:   soa,
-			Count: count,
-		})
-		return
-	}
+// addZone records the results of a zone; workers call it concurrently.
+func addZone(zone ZoneInfo) {
+	zonesMu.Lock()
+	zones = append(zones, zone)
+	zonesMu.Unlock()
+	metrics.zoneDone(zone)
+}
 
-	stream, err := os.Open(zonefile)
-	if err != nil {
+func makeDomainsFile(ctx context.Context, file ZoneFile) error {
+	start := time.Now()
+	zonefile := file.Path
+
+	var stream io.ReadCloser
+	var err error
+	if isRemote(zonefile) {
+		if stream, err = openRemote(ctx, zonefile); err != nil {
+			return err
+		}
+	} else if stream, err = os.Open(zonefile); err != nil {
+		if *validateOnly {
+			// a zone that cannot be read does not validate
+			return err
+		}
 		log.Printf("ERR: %s not found; skipping", zonefile)
-		return
+		return nil
 	}
 	defer stream.Close()
 
-	gz, err := gzip.NewReader(stream)
+	zoneReader, err := compression.Open(stream)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer gz.Close()
+	defer zoneReader.Close()
 
-	var record zoneparse.Record
-	scanner := zoneparse.NewScanner(gz)
+	// Special case -special-zones files, unless validating all records
+	if file.IsSpecialFormat && !*validateOnly {
+		return makeComDomainsFile(ctx, zonefile, zoneReader, start)
+	}
 
-	stuff := make(map[string]struct{})
+	zone, stuff, err := ParseZone(ctx, zoneReader, processingOptions())
+	if err != nil {
+		return err
+	}
+	zone.ParseDuration = time.Since(start)
+	if *validateOnly {
+		addZone(zone)
+		return nil
+	}
 
-	var zone ZoneInfo
-	for {
-		err := scanner.Next(&record)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			//log.Println(err)
-			continue
-		}
+	zone.OutputFile = outputPath(zonefile)
+	if err := writeDomains(zone.OutputFile, stuff); err != nil {
+		return err
+	}
+	addZone(zone)
+
+	stuff = nil
+	// Yes, forcing gc locks program, but worth the time delay for memory save.
+	// some zone file can be quite large.
+	runtime.GC()
+	return nil
+}
+
+// makeComDomainsFile handles the -special-zones files, such as the com zone,
+// which are too large for the generic parser, with comparse. zoneReader is
+// the decompressed zone.
+func makeComDomainsFile(ctx context.Context, zonefile string, zoneReader io.Reader, start time.Time) error {
+	path := outputPath(zonefile)
+	opts := comparse.Options{
+		ShardCount:  *shardCount,
+		Compression: *outputCompression,
+		Filter:      processingOptions().keep,
+		SLDOnly:     *sldOnly,
+		TLD:         zoneTLD(zonefile),
+	}
+	soa, serial, count, err := comparse.ParseFile(ctxReader{ctx, zoneReader}, path, opts)
+	if err != nil {
+		return err
+	}
+
+	zone := ZoneInfo{
+		SOA:           soa,
+		SerialNumber:  serial,
+		Count:         count,
+		ParseDuration: time.Since(start),
+	}
+	if *shardCount > 1 {
+		zone.ShardFiles = comparse.OutputFiles(path, opts)
+	} else {
+		zone.OutputFile = path
+	}
+	if *sampleRate < 1 {
+		zone.SampleRate = *sampleRate
+	}
+	addZone(zone)
+	return nil
+}
 
-		v("a '%s' Record for domain/subdomain '%s'\n",
-			record.Type,
-			record.DomainName,
-		)
-		if fmt.Sprintf("%s", record.Type) == "SOA" {
-			zone.SOA = record.DomainName
+// ctxReader fails reads from r once ctx is done, so that parsers without a
+// context stop with the run.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// outputPath returns the domains file for zonefile: next to it, or in
+// -output-dir when set.
+func outputPath(zonefile string) string {
+	if isRemote(zonefile) {
+		// downloads are written next to local output
+		dir := *outputDir
+		if len(dir) == 0 {
+			dir = *directory
 		}
-		stuff[strings.TrimRight(record.DomainName, ".")] = struct{}{}
+		zonefile = filepath.Join(dir, remoteBase(zonefile))
 	}
-	zone.Count = uint(len(stuff))
-	zones = append(zones, zone)
-	outputFile, err := os.Create(strings.TrimSuffix(zonefile, ".gz") + "_domains.gz")
+	name := compression.TrimExtension(zonefile) + "_domains" + compression.Extension(*outputCompression)
+	if len(*outputDir) != 0 {
+		name = filepath.Join(*outputDir, filepath.Base(name))
+	}
+	return name
+}
+
+// writeDomains writes domains to path, compressed per -output-compression. The file is written
+// under a temporary name and renamed into place once complete.
+func writeDomains(path string, domains map[string]struct{}) error {
+	outputFile, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Abort()
+
+	w, err := compression.NewWriter(outputFile, *outputCompression)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	// sorted, so that runs can be compared with -diff
+	sorted := make([]string, 0, len(domains))
+	for elem := range domains {
+		sorted = append(sorted, elem)
+	}
+	sort.Strings(sorted)
+	for _, elem := range sorted {
+		if _, err := w.Write([]byte(elem + "\n")); err != nil {
+			return err
+		}
 	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return outputFile.Commit()
+}
 
-	gzw := gzip.NewWriter(outputFile)
-	defer gzw.Close()
+// writeAggregate k-way merges the sorted per-zone outputs into path.
+func writeAggregate(path string) error {
+	zonesMu.Lock()
+	var files []string
+	for _, zone := range zones {
+		if len(zone.OutputFile) != 0 {
+			files = append(files, zone.OutputFile)
+		}
+		files = append(files, zone.ShardFiles...)
+	}
+	zonesMu.Unlock()
 
-	for elem := range stuff {
-		_, _ = gzw.Write([]byte(elem + "\n"))
+	outputFile, err := atomicfile.Create(path)
+	if err != nil {
+		return err
 	}
-	stuff = nil
-	// Yes, forcing gc locks program, but worth the time delay for memory save.
-	// some zone file can be quite large.
-	runtime.GC()
+	defer outputFile.Abort()
+
+	w, err := compression.NewWriter(outputFile, *outputCompression)
+	if err != nil {
+		return err
+	}
+	if err := comparse.MergeResults(files, w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return outputFile.Commit()
 }
 
 func writeStatsFile() {
-	f, err := os.Create(*directory + "stats")
+	path := *directory + "stats"
+	if len(*outputDir) != 0 {
+		path = filepath.Join(*outputDir, "stats")
+	}
+	f, err := atomicfile.Create(path)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	defer f.Abort()
+
+	if err := writeStats(f); err != nil {
+		fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		fatal(err)
+	}
+}
+
+// writeStats writes the stats of all zones to w in -stats-format.
+func writeStats(w io.Writer) error {
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	switch *statsFormat {
+	case "json":
+		return writeStatsJSON(w, zones)
+	case "csv":
+		return writeStatsCSV(w, zones)
 	}
-	defer f.Close()
 	for _, zone := range zones {
-		f.WriteString(fmt.Sprintf("SOA: %20s\tNum.Domains: %d\n", zone.SOA, zone.Count))
+		if _, err := io.WriteString(w, zone.Stats()); err != nil {
+			return err
+		}
 	}
-	f.Sync()
+	return nil
+}
+
+func writeStatsJSON(w io.Writer, zones []ZoneInfo) error {
+	if zones == nil {
+		zones = []ZoneInfo{}
+	}
+	data, err := json.MarshalIndent(zones, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeStatsCSV writes one row per zone with the scalar ZoneInfo fields.
+func writeStatsCSV(w io.Writer, zones []ZoneInfo) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"soa", "serial", "count", "parse_errors", "parse_duration_ns", "bytes_read", "throughput_mbps"})
+	for _, zone := range zones {
+		cw.Write([]string{
+			zone.SOA,
+			strconv.FormatUint(uint64(zone.SerialNumber), 10),
+			strconv.FormatUint(uint64(zone.Count), 10),
+			strconv.FormatUint(uint64(zone.ParseErrorCount), 10),
+			strconv.FormatInt(int64(zone.ParseDuration), 10),
+			strconv.FormatInt(zone.BytesRead, 10),
+			strconv.FormatFloat(zone.ThroughputMBps(), 'f', 1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// newDomainFilter returns a matcher for pattern, a glob or, with an "re:"
+// prefix, a regular expression. Domains are matched without the trailing dot.
+func newDomainFilter(pattern string) (func(domain string) bool, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(pattern[len("re:"):])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(domain string) bool {
+		matched, _ := path.Match(pattern, domain)
+		return matched
+	}, nil
+}
+
+// sampled reports whether domain belongs to the sample of the given rate. The
+// choice depends only on the name, so repeated runs select the same domains.
+func sampled(domain string, rate float64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return h.Sum32()%1000 < uint32(rate*1000)
+}
+
+// decodeIDNA converts the punycode labels of domain to Unicode. Labels that
+// fail to decode are kept in their ACE form.
+func decodeIDNA(domain string) string {
+	if !strings.Contains(domain, "xn--") {
+		return domain
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		decoded, err := idna.ToUnicode(label)
+		if err != nil {
+			v("cannot decode %s in %s: %s", label, domain, err)
+			continue
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, ".")
+}
+
+// secondLevel returns the name directly below apex that domain lies in, or
+// domain itself when it is the apex or outside it.
+func secondLevel(domain, apex string) string {
+	if !strings.HasSuffix(domain, "."+apex) {
+		return domain
+	}
+	rest := strings.TrimSuffix(domain, "."+apex)
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + apex
+}
+
+// srvService returns the "_service._proto" prefix of an SRV owner name, or
+// an empty string if the name does not start with one.
+func srvService(name string) string {
+	labels := strings.SplitN(strings.ToLower(name), ".", 3)
+	if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return ""
+	}
+	return labels[0] + "." + labels[1]
+}
+
+// topCounts returns up to n keys with the highest counts, as "key (count)",
+// highest first.
+func topCounts(counts map[string]uint, n int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	top := make([]string, len(names))
+	for i, name := range names {
+		top[i] = fmt.Sprintf("%s (%d)", name, counts[name])
+	}
+	return top
+}
+
+// handleSignals cancels the run on SIGINT or SIGTERM. The returned channel
+// is closed once a signal was received.
+func handleSignals(ctx context.Context, cancel context.CancelFunc) <-chan struct{} {
+	interrupted := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Printf("received %s; stopping", sig)
+			close(interrupted)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return interrupted
 }
 
 func main() {
 	checkFlags()
+	defer closeLog()
 
-	matches, err := filepath.Glob(*directory + "*.txt.gz")
-	if err != nil {
-		log.Fatal(err)
+	var matches []ZoneFile
+	if len(*directory) != 0 {
+		scanned, err := ZoneDirectory{Dir: *directory, Pattern: *inputPattern}.Scan()
+		if err != nil {
+			fatal(err)
+		}
+		matches = scanned
+	}
+	// zone files and URLs named on the command line
+	for _, arg := range flag.Args() {
+		zf, err := newZoneFile(arg)
+		if err != nil {
+			log.Printf("ERR: %s: %s; skipping", arg, err)
+			continue
+		}
+		matches = append(matches, zf)
 	}
-
-	// add com and org
-	matches = append(matches, []string{*directory + "com.zone.gz", *directory + "org.zone.gz"}...)
 
 	bar := pb.New(len(matches))
 	if *pbar {
 		bar.Start()
 	}
-	go loadFilesToProcess(matches)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	interrupted := handleSignals(ctx, cancel)
+
+	if len(*metricsAddr) != 0 {
+		m, err := startMetricsServer(ctx, *metricsAddr)
+		if err != nil {
+			fatal(err)
+		}
+		metrics = m
+		metrics.setZones(len(matches))
+	}
+
 	v("starting %d parallel processing", *parallel)
-	for i := uint(0); i < *parallel; i++ {
-		go worker(bar)
+	pool := workerpool.New(int(*parallel))
+	done := make(chan struct{})
+	go func() {
+		for _, file := range matches {
+			if ctx.Err() != nil {
+				break
+			}
+			file := file
+			pool.Submit(func() { processZone(ctx, bar, file) })
+		}
+		if err := pool.Wait(); err != nil {
+			log.Printf("ERR: %s", err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-interrupted:
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			log.Printf("zones still in progress after %s; writing partial stats", shutdownTimeout)
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("processing stopped early: %s", ctx.Err())
+	}
+
+	if *validateOnly {
+		if err := writeStats(os.Stdout); err != nil {
+			fatal(err)
+		}
+		zonesMu.Lock()
+		for _, failure := range failedZones {
+			fmt.Printf("Failed: %s\n", failure)
+		}
+		zonesMu.Unlock()
+		if validationFailed() || ctx.Err() != nil {
+			closeLog()
+			os.Exit(exitInvalid)
+		}
+		return
 	}
-	<-loadDone
-	work.Wait()
 
 	writeStatsFile()
+	if previousSerials != nil && ctx.Err() == nil {
+		dir := *outputDir
+		if len(dir) == 0 {
+			dir = *directory
+		}
+		if err := compareSerials(dir); err != nil {
+			log.Printf("ERR: comparing serials: %s", err)
+		}
+	}
+	if len(*diffDir) != 0 && ctx.Err() == nil {
+		diffZones()
+	}
+	if len(*aggregateOutput) != 0 && ctx.Err() == nil {
+		if err := writeAggregate(*aggregateOutput); err != nil {
+			log.Printf("ERR: %s: %s", *aggregateOutput, err)
+		}
+	}
+
+	select {
+	case <-interrupted:
+		closeLog()
+		os.Exit(exitInterrupted)
+	default:
+	}
 
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zf-analysis/zoneparse"
+)
+
+// resetZones clears the zones collected by earlier tests.
+func resetZones(t *testing.T) {
+	t.Helper()
+	zonesMu.Lock()
+	zones, failedZones = nil, nil
+	zonesMu.Unlock()
+	t.Cleanup(func() { zones, failedZones = nil, nil })
+}
+
+func TestMakeComDomainsFile(t *testing.T) {
+	const zone = "com. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1700000000 1800 900 604800 86400\n" +
+		"example.com. 172800 IN NS ns1.example.com.\n" +
+		"other 172800 in ns ns1.other\n"
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(zone))
+	gz.Close()
+	path := filepath.Join(dir, "com.zone.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := ZoneFile{Path: path, IsSpecialFormat: true}
+
+	t.Run("ok", func(t *testing.T) {
+		resetZones(t)
+		if err := makeDomainsFile(context.Background(), file); err != nil {
+			t.Fatal(err)
+		}
+		if len(zones) != 1 || zones[0].SOA != "com." || zones[0].SerialNumber != 1700000000 || zones[0].Count != 2 {
+			t.Fatalf("got zones %+v", zones)
+		}
+
+		f, err := os.Open(zones[0].OutputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "example.com\nother.com\n"; string(out) != want {
+			t.Errorf("output %q, want %q", out, want)
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		resetZones(t)
+		defer func(n int) { *shardCount = n }(*shardCount)
+		*shardCount = 2
+		if err := makeDomainsFile(context.Background(), file); err != nil {
+			t.Fatal(err)
+		}
+		if len(zones) != 1 || len(zones[0].OutputFile) != 0 || len(zones[0].ShardFiles) != 2 || zones[0].Count != 2 {
+			t.Fatalf("got zones %+v", zones)
+		}
+		var lines int
+		for _, shard := range zones[0].ShardFiles {
+			lines += strings.Count(readOutput(t, shard), "\n")
+		}
+		if lines != 2 {
+			t.Errorf("shards hold %d domains, want 2", lines)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		resetZones(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := makeDomainsFile(ctx, file); err != context.Canceled {
+			t.Errorf("err = %v, want %v", err, context.Canceled)
+		}
+		if len(zones) != 0 {
+			t.Errorf("cancelled zone was added: %+v", zones)
+		}
+	})
+}
+
+// readOutput returns the lines of the gzipped domains file at path.
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func gzipBytes(data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(data))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestMakeDomainsFile(t *testing.T) {
+	const want = "example\nmail.example\nwww.example\n"
+
+	fails := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fails > 0 {
+			fails--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(gzipBytes(testZone))
+	}))
+	defer srv.Close()
+	httpClient = newHTTPClient(time.Second)
+
+	dir := t.TempDir()
+	defer func(dir string) { *outputDir = dir }(*outputDir)
+	*outputDir = dir
+
+	for _, tc := range []struct {
+		name   string
+		file   string // written to dir unless remote
+		data   []byte
+		output string
+	}{
+		{name: "plain", file: "plain.txt", data: []byte(testZone), output: "plain.txt_domains.gz"},
+		{name: "gzip", file: "gz.txt.gz", data: gzipBytes(testZone), output: "gz.txt_domains.gz"},
+		{name: "remote after a 503", file: srv.URL + "/zones/net.txt.gz?token=x", output: "net.txt_domains.gz"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resetZones(t)
+			path := tc.file
+			if !isRemote(path) {
+				path = filepath.Join(dir, tc.file)
+				if err := os.WriteFile(path, tc.data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := makeDomainsFile(context.Background(), ZoneFile{Path: path}); err != nil {
+				t.Fatal(err)
+			}
+			output := filepath.Join(dir, tc.output)
+			if got := readOutput(t, output); got != want {
+				t.Errorf("wrote %q, want %q", got, want)
+			}
+			if len(zones) != 1 || zones[0].OutputFile != output || zones[0].SerialNumber != 2024010101 || zones[0].Count != 3 {
+				t.Errorf("got zones %+v", zones)
+			}
+		})
+	}
+}
+
+func TestAddZoneConcurrent(t *testing.T) {
+	// run with -race
+	resetZones(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addZone(ZoneInfo{SOA: fmt.Sprintf("z%d.", i)})
+			var buf bytes.Buffer
+			writeStats(&buf)
+		}(i)
+	}
+	wg.Wait()
+	if len(zones) != 50 {
+		t.Errorf("got %d zones, want 50", len(zones))
+	}
+}
+
+func TestDomainFilter(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		match   []string
+		nomatch []string
+	}{
+		{pattern: "*.amazon", match: []string{"foo.amazon"}, nomatch: []string{"foo.amazon.com", "amazon"}},
+		{pattern: "re:^xn--", match: []string{"xn--abc.example"}, nomatch: []string{"abc.xn--x"}},
+		{pattern: "[", nomatch: nil},
+		{pattern: "re:(", nomatch: nil},
+	} {
+		filter, err := newDomainFilter(tc.pattern)
+		if tc.match == nil && tc.nomatch == nil {
+			if err == nil {
+				t.Errorf("%q: no error for an invalid pattern", tc.pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %s", tc.pattern, err)
+		}
+		for _, domain := range tc.match {
+			if !filter(domain) {
+				t.Errorf("%q does not match %s", tc.pattern, domain)
+			}
+		}
+		for _, domain := range tc.nomatch {
+			if filter(domain) {
+				t.Errorf("%q matches %s", tc.pattern, domain)
+			}
+		}
+	}
+}
+
+func TestNameHelpers(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"secondLevel below", secondLevel("a.b.ex", "ex"), "b.ex"},
+		{"secondLevel apex", secondLevel("ex", "ex"), "ex"},
+		{"secondLevel outside", secondLevel("a.b.other", "ex"), "a.b.other"},
+		{"srvService", srvService("_SIP._tcp.example."), "_sip._tcp"},
+		{"srvService plain", srvService("www.example."), ""},
+		{"decodeIDNA", decodeIDNA("www.xn--bcher-kva.example"), "www.bücher.example"},
+		{"decodeIDNA ascii", decodeIDNA("www.example"), "www.example"},
+		{"zoneTLD", zoneTLD("/zones/net.txt.gz"), "net"},
+		{"remoteBase", remoteBase("https://example.net/zones/org.txt.gz?token=x"), "org.txt.gz"},
+		{"topCounts", strings.Join(topCounts(map[string]uint{"a": 1, "b": 3, "c": 3}, 2), ", "), "b (3), c (3)"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	zone := ZoneInfo{
+		SOA:              "example.",
+		SerialNumber:     7,
+		Count:            3,
+		ParseErrorCount:  2,
+		BytesRead:        2000000,
+		ParseDuration:    time.Second,
+		MailServers:      []MXSummary{{Exchange: "mail.example", Priority: 10}, {Exchange: "backup.example", Priority: 20}},
+		RecordTypeCounts: map[zoneparse.RecordType]uint{zoneparse.RecordType_A: 2},
+		DNSSECAlgorithms: map[uint8]uint{13: 1},
+	}
+	for _, tc := range []struct {
+		format string
+		want   []string // substrings of the output
+	}{
+		{
+			format: "text",
+			want: []string{
+				"Serial:          7\tNum.Domains: 3\t",
+				"MB/s: 2.0\n",
+				"MX: 10 mail.example, 20 backup.example\n",
+				"TypeA: 2\n",
+				"DNSKEY-Alg[13]: 1 (ECDSA P-256)\n",
+			},
+		},
+		{format: "csv", want: []string{"soa,serial,count,parse_errors,", "example.,7,3,2,1000000000,2000000,2.0\n"}},
+		{format: "json", want: []string{`"serial": 7`, `"parse_error_count": 2`, `"A": 2`}},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			resetZones(t)
+			defer func(format string) { *statsFormat = format }(*statsFormat)
+			*statsFormat = tc.format
+			addZone(zone)
+
+			var buf bytes.Buffer
+			if err := writeStats(&buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output lacks %q:\n%s", want, buf.String())
+				}
+			}
+			if tc.format == "json" {
+				var back []ZoneInfo
+				if err := json.Unmarshal(buf.Bytes(), &back); err != nil || len(back) != 1 || back[0].RecordTypeCounts[zoneparse.RecordType_A] != 2 {
+					t.Errorf("read back %+v, %v", back, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationFailed(t *testing.T) {
+	defer func(validate bool) { *validateOnly = validate }(*validateOnly)
+	*validateOnly = true
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.txt":       testZone,
+		"bad.txt":        testZone + "bad.example. 300 IN A\n",
+		"corrupt.txt.gz": "\x1f\x8b not gzip",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		files  []string
+		failed int
+		want   bool
+	}{
+		{name: "valid", files: []string{"good.txt"}},
+		{name: "parse error", files: []string{"good.txt", "bad.txt"}, want: true},
+		{name: "missing", files: []string{"good.txt", "missing.txt"}, failed: 1, want: true},
+		{name: "corrupt", files: []string{"corrupt.txt.gz"}, failed: 1, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resetZones(t)
+			for _, name := range tc.files {
+				processZone(context.Background(), nil, ZoneFile{Path: filepath.Join(dir, name)})
+			}
+			if got := validationFailed(); got != tc.want || len(failedZones) != tc.failed {
+				t.Errorf("validationFailed() = %t with failed zones %q, want %t with %d", got, failedZones, tc.want, tc.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// zoneMetrics are the Prometheus metrics served with -metrics-addr. Its
+// methods do nothing on a nil *zoneMetrics, so callers need not check
+// whether metrics are enabled.
+type zoneMetrics struct {
+	zonesTotal     prometheus.Gauge
+	zonesProcessed prometheus.Counter
+	domainsTotal   prometheus.Counter
+	errorsTotal    prometheus.Counter
+	duration       prometheus.Histogram
+}
+
+var metrics *zoneMetrics
+
+func newZoneMetrics(reg *prometheus.Registry) *zoneMetrics {
+	m := &zoneMetrics{
+		zonesTotal: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "zones_total",
+			Help: "Number of zones to process in this run.",
+		}),
+		zonesProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zones_processed",
+			Help: "Number of zones processed so far.",
+		}),
+		domainsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "domains_total",
+			Help: "Number of domains written so far.",
+		}),
+		errorsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of zones that failed and records that could not be parsed.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "processing_duration_seconds",
+			Help:    "Time taken to process a zone.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+		}),
+	}
+	reg.MustRegister(m.zonesTotal, m.zonesProcessed, m.domainsTotal, m.errorsTotal, m.duration)
+	return m
+}
+
+// startMetricsServer serves /metrics on addr until ctx is cancelled.
+func startMetricsServer(ctx context.Context, addr string) (*zoneMetrics, error) {
+	reg := prometheus.NewRegistry()
+	m := newZoneMetrics(reg)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERR: metrics server: %s", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	return m, nil
+}
+
+func (m *zoneMetrics) setZones(n int) {
+	if m != nil {
+		m.zonesTotal.Set(float64(n))
+	}
+}
+
+func (m *zoneMetrics) zoneDone(zone ZoneInfo) {
+	if m == nil {
+		return
+	}
+	m.zonesProcessed.Inc()
+	m.domainsTotal.Add(float64(zone.Count))
+	m.errorsTotal.Add(float64(zone.ParseErrorCount))
+	m.duration.Observe(zone.ParseDuration.Seconds())
+}
+
+func (m *zoneMetrics) zoneFailed() {
+	if m != nil {
+		m.errorsTotal.Inc()
+	}
+}
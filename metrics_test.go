@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetrics(t *testing.T) {
+	resetZones(t)
+	reg := prometheus.NewRegistry()
+	defer func(m *zoneMetrics) { metrics = m }(metrics)
+	metrics = newZoneMetrics(reg)
+
+	dir := t.TempDir()
+	defer func(dir string) { *outputDir = dir }(*outputDir)
+	*outputDir = dir
+	good, corrupt := filepath.Join(dir, "example.txt"), filepath.Join(dir, "corrupt.txt.gz")
+	if err := os.WriteFile(good, []byte(testZone+"bad.example. 300 IN A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, []byte("\x1f\x8b not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	metrics.setZones(2)
+	processZone(context.Background(), nil, ZoneFile{Path: good})
+	processZone(context.Background(), nil, ZoneFile{Path: corrupt})
+
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\nzones_total 2\n",
+		"\nzones_processed 1\n",
+		"\ndomains_total 3\n",
+		"\nerrors_total 2\n", // the bad record and the corrupt zone
+		"\nprocessing_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", strings.TrimSpace(want), body)
+		}
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	var m *zoneMetrics
+	m.setZones(1)
+	m.zoneDone(ZoneInfo{Count: 1})
+	m.zoneFailed()
+}
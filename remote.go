@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// isRemote reports whether zonefile is an http:// or https:// URL.
+func isRemote(zonefile string) bool {
+	return strings.HasPrefix(zonefile, "http://") || strings.HasPrefix(zonefile, "https://")
+}
+
+// remoteBase returns the file name part of a zone file URL.
+func remoteBase(zonefile string) string {
+	u, err := url.Parse(zonefile)
+	if err != nil {
+		return path.Base(zonefile)
+	}
+	return path.Base(u.Path)
+}
+
+var httpClient *http.Client
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// only bound the wait for a response; zone downloads can take a long time
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// openRemote GETs zonefile, retrying failed requests and 5xx responses up to
+// -http-retries times. The caller closes the returned body.
+func openRemote(ctx context.Context, zonefile string) (io.ReadCloser, error) {
+	var lastErr error
+	for attempt := uint(0); attempt <= *httpRetries; attempt++ {
+		if attempt > 0 {
+			v("retrying %s (%s)", zonefile, lastErr)
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, zonefile, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+
+		resp.Body.Close()
+		lastErr = fmt.Errorf("GET %s: %s", zonefile, resp.Status)
+		if resp.StatusCode < 500 {
+			break
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zf-analysis/atomicfile"
+)
+
+// previousSerials holds the serial of every zone in -previous-stats, keyed
+// by lower-cased SOA name.
+var previousSerials map[string]uint32
+
+// readStatsSerials returns the serial of every zone in the stats file at
+// path, which may be in any -stats-format.
+func readStatsSerials(path string) (map[string]uint32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make(map[string]uint32)
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var zones []ZoneInfo
+		if err := json.Unmarshal(trimmed, &zones); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, zone := range zones {
+			serials[strings.ToLower(zone.SOA)] = zone.SerialNumber
+		}
+	case bytes.HasPrefix(trimmed, []byte("soa,")):
+		rows, err := csv.NewReader(bytes.NewReader(trimmed)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, row := range rows[1:] {
+			serial, err := strconv.ParseUint(row[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid serial '%s' for %s", path, row[1], row[0])
+			}
+			serials[strings.ToLower(row[0])] = uint32(serial)
+		}
+	default:
+		// text format: "SOA: <name>\tSerial: <serial>\t..." per zone
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[0] != "SOA:" || fields[2] != "Serial:" {
+				continue
+			}
+			serial, err := strconv.ParseUint(fields[3], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid serial '%s' for %s", path, fields[3], fields[1])
+			}
+			serials[strings.ToLower(fields[1])] = uint32(serial)
+		}
+	}
+	return serials, nil
+}
+
+// compareSerials compares the serials of the processed zones with
+// previousSerials and lists the zones in changed_zones.txt,
+// unchanged_zones.txt, added_zones.txt and dropped_zones.txt in dir.
+func compareSerials(dir string) error {
+	var changed, unchanged, added, dropped []string
+
+	current := make(map[string]struct{})
+	zonesMu.Lock()
+	for _, zone := range zones {
+		if len(zone.SOA) == 0 {
+			continue
+		}
+		soa := strings.ToLower(zone.SOA)
+		current[soa] = struct{}{}
+
+		serial, ok := previousSerials[soa]
+		switch {
+		case !ok:
+			added = append(added, soa)
+		case serial != zone.SerialNumber:
+			changed = append(changed, soa)
+		default:
+			unchanged = append(unchanged, soa)
+		}
+	}
+	zonesMu.Unlock()
+	for soa := range previousSerials {
+		if _, ok := current[soa]; !ok {
+			dropped = append(dropped, soa)
+		}
+	}
+
+	lists := map[string][]string{
+		"changed_zones.txt":   changed,
+		"unchanged_zones.txt": unchanged,
+		"added_zones.txt":     added,
+		"dropped_zones.txt":   dropped,
+	}
+	for name, list := range lists {
+		if err := writeZoneList(filepath.Join(dir, name), list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeZoneList writes the sorted zone names to path, one per line.
+func writeZoneList(path string, names []string) error {
+	f, err := atomicfile.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := io.WriteString(f, name+"\n"); err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
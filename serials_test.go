@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadStatsSerials(t *testing.T) {
+	want := map[string]uint32{"example.": 7, "net.": 2024010101}
+	for _, tc := range []struct {
+		name  string
+		stats string
+	}{
+		{name: "text", stats: "SOA: Example.\tSerial:          7\tNum.Domains: 3\n\tMX: 10 mail.example (2)\nSOA: net.\tSerial: 2024010101\n"},
+		{name: "csv", stats: "soa,serial,count\nExample.,7,3\nnet.,2024010101,0\n"},
+		{name: "json", stats: `[{"soa": "Example.", "serial": 7}, {"soa": "net.", "serial": 2024010101}]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stats")
+			if err := os.WriteFile(path, []byte(tc.stats), 0644); err != nil {
+				t.Fatal(err)
+			}
+			serials, err := readStatsSerials(path)
+			if err != nil || !reflect.DeepEqual(serials, want) {
+				t.Errorf("got %v, %v; want %v", serials, err, want)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "stats")
+	os.WriteFile(path, []byte("soa,serial\nnet.,x\n"), 0644)
+	if _, err := readStatsSerials(path); err == nil {
+		t.Error("invalid serial accepted")
+	}
+}
+
+func TestCompareSerials(t *testing.T) {
+	resetZones(t)
+	defer func(serials map[string]uint32) { previousSerials = serials }(previousSerials)
+	previousSerials = map[string]uint32{"a.": 1, "b.": 1, "c.": 1}
+	addZone(ZoneInfo{SOA: "A.", SerialNumber: 1})
+	addZone(ZoneInfo{SOA: "b.", SerialNumber: 2})
+	addZone(ZoneInfo{SOA: "d.", SerialNumber: 1})
+	addZone(ZoneInfo{})
+
+	dir := t.TempDir()
+	if err := compareSerials(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"changed_zones.txt":   "b.\n",
+		"unchanged_zones.txt": "a.\n",
+		"added_zones.txt":     "d.\n",
+		"dropped_zones.txt":   "c.\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 4 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("left %s in the output directory", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,92 @@
+// Package workerpool runs tasks on a fixed number of goroutines.
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrClosed is returned by Submit after Close or Wait.
+var ErrClosed = errors.New("workerpool: pool is closed")
+
+// WorkerPool runs submitted tasks on a fixed number of goroutines, queueing
+// at most one task per goroutine.
+type WorkerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex // held for writing to close jobs
+	closed bool
+
+	errMu sync.Mutex
+	err   error // first panic of a task
+}
+
+// New starts a pool of concurrency goroutines (at least one).
+func New(concurrency int) *WorkerPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p := &WorkerPool{
+		jobs: make(chan func(), concurrency),
+	}
+	p.wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for task := range p.jobs {
+		p.run(task)
+	}
+}
+
+// run calls task, turning a panic into the pool's error.
+func (p *WorkerPool) run(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.errMu.Lock()
+			if p.err == nil {
+				p.err = fmt.Errorf("workerpool: task panicked: %v", r)
+			}
+			p.errMu.Unlock()
+		}
+	}()
+	task()
+}
+
+// Submit queues task, blocking while the queue is full.
+func (p *WorkerPool) Submit(task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.jobs <- task
+	return nil
+}
+
+// Close stops the pool from accepting tasks. Queued tasks still run.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// Wait closes the pool and returns once all submitted tasks have finished.
+// The error reports the first task that panicked, if any.
+func (p *WorkerPool) Wait() error {
+	p.Close()
+	p.wg.Wait()
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
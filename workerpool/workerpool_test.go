@@ -0,0 +1,66 @@
+package workerpool
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWorkerPool(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		concurrency int
+		tasks       int
+		panicAt     int // task that panics; -1 for none
+	}{
+		{name: "one worker", concurrency: 1, tasks: 10, panicAt: -1},
+		{name: "no workers", concurrency: 0, tasks: 10, panicAt: -1},
+		{name: "many workers", concurrency: 8, tasks: 1000, panicAt: -1},
+		{name: "panic", concurrency: 4, tasks: 100, panicAt: 7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New(tc.concurrency)
+			var ran int64
+			for i := 0; i < tc.tasks; i++ {
+				i := i
+				if err := p.Submit(func() {
+					atomic.AddInt64(&ran, 1)
+					if i == tc.panicAt {
+						panic("boom")
+					}
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := p.Wait()
+			if ran != int64(tc.tasks) {
+				t.Errorf("%d of %d tasks ran", ran, tc.tasks)
+			}
+			if (err != nil) != (tc.panicAt >= 0) || (err != nil && !strings.Contains(err.Error(), "boom")) {
+				t.Errorf("Wait() = %v", err)
+			}
+			if err := p.Submit(func() {}); err != ErrClosed {
+				t.Errorf("Submit after Wait = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolConcurrentClose(t *testing.T) {
+	p := New(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p.Submit(func() {}) == nil {
+			}
+		}()
+	}
+	p.Close()
+	wg.Wait()
+	if err := p.Wait(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"zf-analysis/zoneparse"
+)
+
+// ProcessingOptions controls which domains ParseZone collects and which
+// statistics it gathers.
+type ProcessingOptions struct {
+	FilterTypes   []zoneparse.RecordType // only collect owners of these types; all when empty
+	CaseFold      bool                   // lower-case domains before deduplicating them
+	SkipWildcards bool                   // do not collect wildcard owners such as *.example; otherwise their parent is collected
+	SkipDNSSEC    bool                   // do not collect owners of DNSSEC records
+	SLDOnly       bool                   // collect the name directly below the apex instead
+	IDNADecode    bool                   // convert punycode labels to Unicode
+	DomainFilter  func(domain string) bool
+	MaxDomains    uint    // stop collecting new domains after this many; no limit when 0
+	SampleRate    float64 // only collect this fraction of domains, see sampled; all when 0 or 1
+	MinLabels     int     // skip domains with fewer labels; no limit when 0
+	MaxLabels     int     // skip domains with more labels; no limit when 0
+
+	IncludeMX   bool
+	IncludeNS   bool
+	IncludeSRV  bool
+	TypeStats   bool
+	DomainStats bool
+	TTLStats    bool
+}
+
+// processingOptions returns the ProcessingOptions selected by the flags.
+func processingOptions() ProcessingOptions {
+	opts := ProcessingOptions{
+		CaseFold:      true,
+		SkipWildcards: *skipWildcards,
+		SkipDNSSEC:    *skipDNSSEC,
+		SLDOnly:       *sldOnly,
+		IDNADecode:    *idnaDecode,
+		DomainFilter:  domainFilter,
+		MaxDomains:    *maxDomains,
+		SampleRate:    *sampleRate,
+		MinLabels:     *minLabels,
+		MaxLabels:     *maxLabels,
+		IncludeMX:     *includeMX,
+		IncludeNS:     *includeNS,
+		IncludeSRV:    *includeSRV,
+		TypeStats:     *typeStats,
+		DomainStats:   *domainStats,
+		TTLStats:      *ttlStats,
+	}
+	for rt := range filterTypes {
+		opts.FilterTypes = append(opts.FilterTypes, rt)
+	}
+	return opts
+}
+
+// keep reports whether domain, without the trailing dot, passes the label
+// range, DomainFilter and sampling of opts.
+func (opts ProcessingOptions) keep(domain string) bool {
+	if labels := labelCount(domain); labels < opts.MinLabels || (opts.MaxLabels > 0 && labels > opts.MaxLabels) {
+		return false
+	}
+	if opts.DomainFilter != nil && !opts.DomainFilter(domain) {
+		return false
+	}
+	if opts.SampleRate > 0 && opts.SampleRate < 1 && !sampled(domain, opts.SampleRate) {
+		return false
+	}
+	return true
+}
+
+// labelCount returns the number of labels of domain; 0 for the root.
+func labelCount(domain string) int {
+	if len(domain) == 0 {
+		return 0
+	}
+	return strings.Count(domain, ".") + 1
+}
+
+// maxParseErrors is the number of parse error messages kept per zone. Later
+// errors are only counted.
+const maxParseErrors = 1000
+
+// ParseZone reads the uncompressed zone r and returns its statistics and
+// the set of domains selected by opts, without trailing dots.
+func ParseZone(ctx context.Context, r io.Reader, opts ProcessingOptions) (ZoneInfo, map[string]struct{}, error) {
+	var types zoneparse.RecordTypeSet
+	if len(opts.FilterTypes) != 0 {
+		types = make(zoneparse.RecordTypeSet)
+		for _, rt := range opts.FilterTypes {
+			types[rt] = struct{}{}
+		}
+	}
+
+	var record zoneparse.Record
+	scanner := zoneparse.NewScannerWithOptions(r, zoneparse.ScannerOptions{
+		SkipUnknownTypes: true,
+	})
+
+	stuff := make(map[string]struct{})
+
+	var zone ZoneInfo
+	if opts.SampleRate > 0 && opts.SampleRate < 1 {
+		zone.SampleRate = opts.SampleRate
+	}
+	mailServers := make(map[string]*MXSummary)
+	if opts.IncludeSRV {
+		zone.SRVServices = make(map[string]uint)
+	}
+	nameservers := make(map[string]struct{})
+	if opts.TypeStats {
+		zone.RecordTypeCounts = make(map[zoneparse.RecordType]uint)
+	}
+	// number of records per TTL value, for the median
+	var ttls map[int64]uint
+	if opts.TTLStats {
+		ttls = make(map[int64]uint)
+	}
+	for n := 0; ; n++ {
+		if n%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return ZoneInfo{}, nil, ctx.Err()
+		}
+
+		err := scanner.Next(&record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if scanner.Err() != nil {
+				// reading failed, not just this record
+				return ZoneInfo{}, nil, err
+			}
+			zone.ParseErrorCount++
+			if len(zone.ParseErrors) < maxParseErrors {
+				zone.ParseErrors = append(zone.ParseErrors, err.Error())
+			}
+			continue
+		}
+
+		v("a '%s' Record for domain/subdomain '%s'\n",
+			record.Type,
+			record.DomainName,
+		)
+		if opts.TypeStats {
+			zone.RecordTypeCounts[record.Type]++
+		}
+		if opts.TTLStats && record.TimeToLive >= 0 {
+			ttls[record.TimeToLive]++
+		}
+		if record.Type == zoneparse.RecordType_SOA {
+			zone.SOA = record.DomainName
+			if soa, err := record.AsSOA(); err == nil {
+				zone.SerialNumber = soa.Serial
+			}
+		}
+		if opts.IncludeMX && record.Type == zoneparse.RecordType_MX {
+			if mx, err := record.AsMX(); err == nil && mx.Exchange != "." {
+				exchange := strings.ToLower(strings.TrimRight(mx.Exchange, "."))
+				if summary, ok := mailServers[exchange]; !ok {
+					mailServers[exchange] = &MXSummary{Exchange: exchange, Priority: mx.Priority}
+				} else if mx.Priority < summary.Priority {
+					summary.Priority = mx.Priority
+				}
+			}
+		}
+		if record.Type == zoneparse.RecordType_DNSKEY {
+			if key, err := record.AsDNSKEY(); err == nil {
+				if zone.DNSSECAlgorithms == nil {
+					zone.DNSSECAlgorithms = make(map[uint8]uint)
+				}
+				zone.DNSSECAlgorithms[key.Algorithm]++
+			}
+		}
+		// only the apex; delegations below it have NS records too
+		if opts.IncludeNS && record.Type == zoneparse.RecordType_NS && len(record.Data) == 1 &&
+			len(zone.SOA) != 0 && strings.EqualFold(record.DomainName, zone.SOA) {
+			nameservers[strings.ToLower(strings.TrimRight(record.Data[0], "."))] = struct{}{}
+		}
+		if opts.IncludeSRV && record.Type == zoneparse.RecordType_SRV {
+			if service := srvService(record.DomainName); len(service) != 0 {
+				zone.SRVServices[service]++
+			}
+		}
+		if types != nil && !types.Contains(record.Type) {
+			continue
+		}
+		if opts.SkipDNSSEC && record.Type.IsDNSSEC() {
+			continue
+		}
+		domain := strings.TrimRight(record.DomainName, ".")
+		if domain == "*" || strings.HasPrefix(domain, "*.") {
+			zone.WildcardCount++
+			if opts.SkipWildcards {
+				continue
+			}
+			// collect the parent the wildcard covers, not the literal "*"
+			domain = strings.TrimPrefix(domain[1:], ".")
+			if len(domain) == 0 {
+				// a bare "*" covers the apex; skip it before the SOA names one
+				if domain = strings.TrimRight(zone.SOA, "."); len(domain) == 0 {
+					continue
+				}
+			}
+		}
+		if opts.CaseFold {
+			// names are case-insensitive (RFC 4343); dedupe them as such
+			domain = strings.ToLower(domain)
+		}
+		if opts.SLDOnly && len(zone.SOA) != 0 {
+			domain = secondLevel(domain, strings.ToLower(strings.TrimRight(zone.SOA, ".")))
+		}
+		if !opts.keep(domain) {
+			continue
+		}
+		if opts.IDNADecode {
+			domain = decodeIDNA(domain)
+		}
+		if opts.MaxDomains > 0 && uint(len(stuff)) >= opts.MaxDomains {
+			if _, seen := stuff[domain]; !seen {
+				zone.Truncated = true
+			}
+			continue
+		}
+		stuff[domain] = struct{}{}
+	}
+	zone.Count = uint(len(stuff))
+	zone.LabelDepthHistogram = make(map[int]uint)
+	if opts.DomainStats {
+		zone.DomainLengthHistogram = make(map[int]uint)
+	}
+	for domain := range stuff {
+		depth := labelCount(domain)
+		zone.LabelDepthHistogram[depth]++
+
+		// the TLD itself has no length of its own
+		if opts.DomainStats && depth > 1 {
+			zone.DomainLengthHistogram[strings.LastIndexByte(domain, '.')]++
+		}
+	}
+	if opts.TTLStats {
+		zone.setTTLStats(ttls)
+	}
+	for _, summary := range mailServers {
+		zone.MailServers = append(zone.MailServers, *summary)
+	}
+	sort.Slice(zone.MailServers, func(i, j int) bool {
+		a, b := zone.MailServers[i], zone.MailServers[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Exchange < b.Exchange
+	})
+	for ns := range nameservers {
+		zone.Nameservers = append(zone.Nameservers, ns)
+	}
+	sort.Strings(zone.Nameservers)
+	zone.BytesRead = int64(scanner.Stats().BytesRead)
+
+	return zone, stuff, nil
+}
+
+// ttlBuckets are the lower bounds of the TTLHistogram buckets.
+var ttlBuckets = []int64{0, 61, 301, 3601, 86401}
+
+// setTTLStats fills the TTL fields of zone from the number of records per
+// TTL value.
+func (zone *ZoneInfo) setTTLStats(ttls map[int64]uint) {
+	zone.TTLHistogram = make(map[int64]uint)
+	if len(ttls) == 0 {
+		return
+	}
+
+	values := make([]int64, 0, len(ttls))
+	var total uint
+	for ttl, n := range ttls {
+		values = append(values, ttl)
+		total += n
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	zone.MinTTL = &values[0]
+	zone.MaxTTL = &values[len(values)-1]
+
+	var seen uint
+	for _, ttl := range values {
+		if seen < (total+1)/2 && seen+ttls[ttl] >= (total+1)/2 {
+			median := ttl
+			zone.MedianTTL = &median
+		}
+		seen += ttls[ttl]
+
+		bucket := sort.Search(len(ttlBuckets), func(i int) bool { return ttlBuckets[i] > ttl }) - 1
+		zone.TTLHistogram[ttlBuckets[bucket]] += ttls[ttl]
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"zf-analysis/compression"
+	"zf-analysis/zoneparse"
+)
+
+const testZone = `example. 3600 IN SOA ns1.example. hostmaster.example. 2024010101 7200 3600 1209600 3600
+example. 3600 IN NS ns1.example.
+www.example. 300 IN A 192.0.2.1
+mail.example. 300 IN A 192.0.2.2
+`
+
+func parseTestZone(t *testing.T, zone string, opts ProcessingOptions) (ZoneInfo, map[string]struct{}) {
+	t.Helper()
+	info, domains, err := ParseZone(context.Background(), strings.NewReader(zone), opts)
+	if err != nil {
+		t.Fatalf("ParseZone: %s", err)
+	}
+	return info, domains
+}
+
+func TestParseZoneTruncatedGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(gz, "d%d.example. 300 IN A 192.0.2.1\n", i)
+	}
+	gz.Close()
+
+	r, err := compression.Open(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseZone(context.Background(), r, ProcessingOptions{}); err == nil {
+		t.Fatal("ParseZone succeeded on a truncated gzip stream")
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		zone    string
+		count   uint
+		kept    int // messages in ParseErrors
+		domains int
+	}{
+		{name: "clean", zone: testZone, domains: 3},
+		{name: "bad record skipped", zone: testZone + "bad.example. 300 IN A\n", count: 1, kept: 1, domains: 3},
+		{name: "many errors", zone: strings.Repeat("bad.example. 300 IN A\n", maxParseErrors+1) + testZone, count: maxParseErrors + 1, kept: maxParseErrors, domains: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, domains, err := ParseZone(context.Background(), strings.NewReader(tc.zone), ProcessingOptions{CaseFold: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.ParseErrorCount != tc.count || len(info.ParseErrors) != tc.kept || len(domains) != tc.domains {
+				t.Errorf("got %d errors (%d kept) and %d domains, want %d (%d kept) and %d",
+					info.ParseErrorCount,
+					len(info.ParseErrors),
+					len(domains),
+					tc.count,
+					tc.kept,
+					tc.domains,
+				)
+			}
+		})
+	}
+}
+
+// richZone exercises the options and statistics of ParseZone.
+const richZone = `Example. 3600 IN SOA ns1.example. hostmaster.example. 2024010101 7200 3600 1209600 3600
+example. 3600 IN NS ns2.example.
+example. 3600 IN NS NS1.example.
+example. 3600 IN MX 20 mail.example.
+example. 3600 IN MX 30 backup.example.
+example. 3600 IN DNSKEY 257 3 13 AwEAAQ==
+WWW.example. 300 IN A 192.0.2.1
+mail.example. 300 IN MX 10 Mail.example.
+a.b.example. 60 IN A 192.0.2.2
+*.wild.example. 60 IN A 192.0.2.3
+_sip._tcp.example. 86400 IN SRV 10 60 5060 sip.example.
+xn--bcher-kva.example. 300 IN A 192.0.2.4
+sub.example. 100000 IN NS ns.other.
+`
+
+func TestParseZoneDomains(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    ProcessingOptions
+		domains string // sorted
+	}{
+		{
+			name:    "filter types",
+			opts:    ProcessingOptions{CaseFold: true, FilterTypes: []zoneparse.RecordType{zoneparse.RecordType_A}},
+			domains: "a.b.example,wild.example,www.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "case fold",
+			opts:    ProcessingOptions{CaseFold: true},
+			domains: "_sip._tcp.example,a.b.example,example,mail.example,sub.example,wild.example,www.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "case kept",
+			domains: "Example,WWW.example,_sip._tcp.example,a.b.example,example,mail.example,sub.example,wild.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "skip dnssec",
+			opts:    ProcessingOptions{CaseFold: true, SkipDNSSEC: true, FilterTypes: []zoneparse.RecordType{zoneparse.RecordType_A, zoneparse.RecordType_DNSKEY}},
+			domains: "a.b.example,wild.example,www.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "skip wildcards",
+			opts:    ProcessingOptions{CaseFold: true, SkipWildcards: true, FilterTypes: []zoneparse.RecordType{zoneparse.RecordType_A}},
+			domains: "a.b.example,www.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "sld only",
+			opts:    ProcessingOptions{CaseFold: true, SLDOnly: true},
+			domains: "_tcp.example,b.example,example,mail.example,sub.example,wild.example,www.example,xn--bcher-kva.example",
+		},
+		{
+			name:    "labels",
+			opts:    ProcessingOptions{CaseFold: true, MinLabels: 3, MaxLabels: 3},
+			domains: "_sip._tcp.example,a.b.example",
+		},
+		{
+			name:    "max labels",
+			opts:    ProcessingOptions{CaseFold: true, MaxLabels: 1},
+			domains: "example",
+		},
+		{
+			name:    "idna",
+			opts:    ProcessingOptions{CaseFold: true, IDNADecode: true, FilterTypes: []zoneparse.RecordType{zoneparse.RecordType_A}},
+			domains: "a.b.example,bücher.example,wild.example,www.example",
+		},
+		{
+			name:    "domain filter",
+			opts:    ProcessingOptions{CaseFold: true, DomainFilter: func(domain string) bool { return strings.HasPrefix(domain, "w") }},
+			domains: "wild.example,www.example",
+		},
+		{
+			name:    "max domains",
+			opts:    ProcessingOptions{CaseFold: true, MaxDomains: 2},
+			domains: "example,www.example",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, domains := parseTestZone(t, richZone, tc.opts)
+			var got []string
+			for domain := range domains {
+				got = append(got, domain)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != tc.domains {
+				t.Errorf("got %s, want %s", strings.Join(got, ","), tc.domains)
+			}
+			if info.Count != uint(len(got)) || info.Truncated != (tc.opts.MaxDomains > 0) {
+				t.Errorf("Count %d, Truncated %t", info.Count, info.Truncated)
+			}
+		})
+	}
+}
+
+func TestParseZoneSampling(t *testing.T) {
+	var zone strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&zone, "d%d.example. 300 IN A 192.0.2.1\n", i)
+	}
+	first, domains := parseTestZone(t, zone.String(), ProcessingOptions{SampleRate: 0.1})
+	if len(domains) < 70 || len(domains) > 130 || first.SampleRate != 0.1 {
+		t.Errorf("sampled %d of 1000 domains at rate %g", len(domains), first.SampleRate)
+	}
+	_, again := parseTestZone(t, zone.String(), ProcessingOptions{SampleRate: 0.1})
+	for domain := range domains {
+		if _, ok := again[domain]; !ok {
+			t.Fatalf("%s not sampled the second time", domain)
+		}
+	}
+}
+
+func TestParseZoneStats(t *testing.T) {
+	info, _ := parseTestZone(t, richZone, ProcessingOptions{
+		CaseFold:    true,
+		IncludeMX:   true,
+		IncludeNS:   true,
+		IncludeSRV:  true,
+		TypeStats:   true,
+		DomainStats: true,
+		TTLStats:    true,
+	})
+	for _, tc := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"SOA", info.SOA, "Example."},
+		{"SerialNumber", info.SerialNumber, uint32(2024010101)},
+		{"WildcardCount", info.WildcardCount, uint(1)},
+		{"MailServers", info.MailServers, []MXSummary{{Exchange: "mail.example", Priority: 10}, {Exchange: "backup.example", Priority: 30}}},
+		{"Nameservers", info.Nameservers, []string{"ns1.example", "ns2.example"}},
+		{"SRVServices", info.SRVServices, map[string]uint{"_sip._tcp": 1}},
+		{"DNSSECAlgorithms", info.DNSSECAlgorithms, map[uint8]uint{13: 1}},
+		{"RecordTypeCounts[A]", info.RecordTypeCounts[zoneparse.RecordType_A], uint(4)},
+		{"RecordTypeCounts[NS]", info.RecordTypeCounts[zoneparse.RecordType_NS], uint(3)},
+		{"LabelDepthHistogram", info.LabelDepthHistogram, map[int]uint{1: 1, 2: 5, 3: 2}},
+		{"DomainLengthHistogram", info.DomainLengthHistogram, map[int]uint{3: 3, 4: 2, 9: 1, 13: 1}},
+		{"TTLHistogram", info.TTLHistogram, map[int64]uint{0: 2, 61: 3, 301: 6, 3601: 1, 86401: 1}},
+		{"MinTTL", *info.MinTTL, int64(60)},
+		{"MedianTTL", *info.MedianTTL, int64(3600)},
+		{"MaxTTL", *info.MaxTTL, int64(100000)},
+		{"BytesRead", info.BytesRead, int64(len(richZone))},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestParseZoneBareWildcard(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		zone    string
+		domains string
+	}{
+		{name: "apex", zone: testZone + "* 300 IN A 192.0.2.3\n", domains: "example,mail.example,www.example"},
+		{name: "absolute", zone: testZone + "*. 300 IN A 192.0.2.3\n", domains: "example,mail.example,www.example"},
+		{name: "before the SOA", zone: "* 300 IN A 192.0.2.3\nwww.example. 300 IN A 192.0.2.1\n", domains: "www.example"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, domains := parseTestZone(t, tc.zone, ProcessingOptions{CaseFold: true})
+			var got []string
+			for domain := range domains {
+				got = append(got, domain)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != tc.domains || info.WildcardCount != 1 {
+				t.Errorf("got %s with %d wildcards, want %s with 1", strings.Join(got, ","), info.WildcardCount, tc.domains)
+			}
+		})
+	}
+}
+
+func TestParseZoneZeroTTL(t *testing.T) {
+	info, _ := parseTestZone(t, "example. 0 IN A 192.0.2.1\nwww.example. 0 IN A 192.0.2.2\n", ProcessingOptions{TTLStats: true})
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"min_ttl":0`, `"median_ttl":0`, `"max_ttl":0`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON lacks %s: %s", want, data)
+		}
+	}
+
+	info, _ = parseTestZone(t, testZone, ProcessingOptions{})
+	if data, _ := json.Marshal(info); strings.Contains(string(data), "min_ttl") {
+		t.Errorf("JSON has min_ttl without -ttl-stats: %s", data)
+	}
+}
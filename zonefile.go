@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zf-analysis/compression"
+)
+
+// ZoneFile is a zone file to process, local or remote, with what is known
+// about it up front.
+type ZoneFile struct {
+	Path            string
+	Size            int64 // 0 for remote files
+	ModTime         time.Time
+	IsSpecialFormat bool   // listed in -special-zones, parsed by comparse
+	CompressedWith  string // compression.Gzip, Zstd or None; empty for remote files
+}
+
+// isSpecialZone reports whether the zone file at path is in -special-zones.
+func isSpecialZone(path string) bool {
+	for _, name := range strings.Split(*specialZones, ",") {
+		if strings.TrimSpace(name) == filepath.Base(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneTLD returns the zone a special zone file is named after, e.g. "org"
+// for org.zone.gz.
+func zoneTLD(path string) string {
+	return strings.SplitN(filepath.Base(path), ".", 2)[0]
+}
+
+// newZoneFile returns the ZoneFile for path, reading the metadata of local
+// files.
+func newZoneFile(path string) (ZoneFile, error) {
+	zf := ZoneFile{Path: path}
+	if isRemote(path) {
+		return zf, nil
+	}
+	zf.IsSpecialFormat = isSpecialZone(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return zf, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return zf, err
+	}
+	zf.Size = info.Size()
+	zf.ModTime = info.ModTime()
+	zf.CompressedWith, err = compression.Detect(f)
+	return zf, err
+}
+
+// ZoneDirectory is a directory of zone files.
+type ZoneDirectory struct {
+	Dir     string
+	Pattern string // glob of file names to process
+}
+
+// Scan returns the zone files in the directory matching Pattern sorted by
+// name, followed by the -special-zones files present. Output files of
+// earlier runs are skipped.
+func (d ZoneDirectory) Scan() ([]ZoneFile, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files, last []ZoneFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.Contains(name, "_domains") {
+			// don't pick up our own output with broad patterns
+			continue
+		}
+		matched, err := filepath.Match(d.Pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		big := isSpecialZone(name)
+		if !matched && !big {
+			continue
+		}
+
+		zf, err := newZoneFile(filepath.Join(d.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if big {
+			last = append(last, zf)
+		} else {
+			files = append(files, zf)
+		}
+	}
+	return append(files, last...), nil
+}
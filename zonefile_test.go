@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zf-analysis/compression"
+)
+
+func TestZoneDirectoryScan(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"b.txt":            []byte(testZone),
+		"a.txt":            gzipBytes(testZone),
+		"a.txt_domains.gz": gzipBytes("example\n"),
+		"other.zone":       []byte(testZone),
+		"com.zone.gz":      gzipBytes(testZone),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "c.txt"), 0755)
+
+	files, err := ZoneDirectory{Dir: dir, Pattern: "*.txt"}.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []ZoneFile{
+		{Path: filepath.Join(dir, "a.txt"), CompressedWith: compression.Gzip},
+		{Path: filepath.Join(dir, "b.txt"), Size: int64(len(testZone)), CompressedWith: compression.None},
+		{Path: filepath.Join(dir, "com.zone.gz"), IsSpecialFormat: true, CompressedWith: compression.Gzip},
+	} {
+		if i >= len(files) {
+			t.Fatalf("got %d files, want 3", len(files))
+		}
+		got := files[i]
+		if want.Size == 0 {
+			want.Size = got.Size
+		}
+		want.ModTime = got.ModTime
+		if got != want {
+			t.Errorf("file %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if len(files) != 3 {
+		t.Errorf("got %d files, want 3", len(files))
+	}
+
+	if _, err := (ZoneDirectory{Dir: dir, Pattern: "["}).Scan(); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	if tld := zoneTLD(filepath.Join(dir, "org.zone.gz")); tld != "org" {
+		t.Errorf("zoneTLD = %s, want org", tld)
+	}
+}
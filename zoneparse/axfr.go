@@ -0,0 +1,66 @@
+package zoneparse
+
+import (
+	"fmt"
+	"io"
+)
+
+// ZoneTransferScanner reads the records of an AXFR response, which starts
+// and ends with the zone's SOA record. The opening SOA is returned like any
+// other record; Next returns io.EOF at the closing SOA.
+type ZoneTransferScanner struct {
+	scanner *Scanner
+	apex    string
+	serial  uint32
+	started bool
+	done    bool
+}
+
+func NewZoneTransferScanner(s *Scanner) *ZoneTransferScanner {
+	return &ZoneTransferScanner{scanner: s}
+}
+
+// Apex returns the owner name of the opening SOA record, or an empty string
+// before the first record was read.
+func (z *ZoneTransferScanner) Apex() string {
+	return z.apex
+}
+
+// Serial returns the serial of the opening SOA record.
+func (z *ZoneTransferScanner) Serial() uint32 {
+	return z.serial
+}
+
+func (z *ZoneTransferScanner) Next(outrecord *Record) error {
+	if z.done {
+		return io.EOF
+	}
+
+	var record Record
+	if err := z.scanner.Next(&record); err != nil {
+		if err == io.EOF {
+			if !z.started {
+				return io.EOF
+			}
+			// no closing SOA: the transfer was cut short
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if !z.started {
+		soa, err := record.AsSOA()
+		if err != nil {
+			return fmt.Errorf("zone transfer does not start with an SOA record: %s", err)
+		}
+		z.started = true
+		z.apex = record.DomainName
+		z.serial = soa.Serial
+	} else if record.Type == RecordType_SOA && record.IsApex(z.apex) {
+		z.done = true
+		return io.EOF
+	}
+
+	*outrecord = record
+	return nil
+}
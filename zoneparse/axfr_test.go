@@ -0,0 +1,41 @@
+package zoneparse
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestZoneTransferScanner(t *testing.T) {
+	const soa = "ex. 1 IN SOA a. b. 7 1 2 3 4\n"
+	for _, tc := range []struct {
+		name    string
+		in      string
+		records int
+		err     error // returned after the records; nil when any other error is expected
+	}{
+		{name: "complete", in: soa + "foo.ex. IN A 192.0.2.1\n" + soa + "bar.ex. IN A 192.0.2.1\n", records: 2, err: io.EOF},
+		{name: "empty", in: "", err: io.EOF},
+		{name: "cut short", in: soa + "foo.ex. IN A 192.0.2.1\n", records: 2, err: io.ErrUnexpectedEOF},
+		{name: "no SOA", in: "foo.ex. IN A 192.0.2.1\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			z := NewZoneTransferScanner(NewScanner(strings.NewReader(tc.in)))
+			var record Record
+			var n int
+			var err error
+			for err = z.Next(&record); err == nil; err = z.Next(&record) {
+				n++
+			}
+			if tc.err == nil && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				t.Errorf("got %v, want a scanner error", err)
+			}
+			if n != tc.records || (tc.err != nil && err != tc.err) {
+				t.Errorf("got %d records and %v, want %d and %v", n, err, tc.records, tc.err)
+			}
+			if n > 0 && (z.Apex() != "ex." || z.Serial() != 7) {
+				t.Errorf("apex %s serial %d", z.Apex(), z.Serial())
+			}
+		})
+	}
+}
@@ -2,82 +2,394 @@ package comparse
 
 import (
 	"bufio"
-	"compress/gzip"
-	"log"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+
+	"zf-analysis/atomicfile"
+	"zf-analysis/compression"
 )
 
-func sortFunc(domains *map[string]struct{}) (sd *[]string) {
+// batchLines is how many input lines Parse reads before writing out the
+// domains collected so far, bounding its memory use.
+var batchLines = 50000000 // 50M
+
+// Options controls how Parse selects and writes domains.
+type Options struct {
+	// PreserveOrder writes each batch of domains in the order they were
+	// first seen instead of sorting them. Domains are still deduplicated.
+	PreserveOrder bool
+
+	// TempDir is where in-progress output files and the sorted batches
+	// spilled when the zone is too large to collect in one are written.
+	// ParseFile defaults it to the directory of its output, so the final
+	// rename stays on one filesystem; Parse and ParseShards, which are given
+	// writers, default to the system temp directory.
+	TempDir string
+
+	// ShardCount, when > 1, makes ParseFile split its output over
+	// ShardCount files named <base>_shard_N<ext>. Each domain goes to shard
+	// hash(domain) % ShardCount.
+	ShardCount int
+
+	// Compression is the format of the files ParseFile writes:
+	// compression.Gzip (default), compression.Zstd or compression.None.
+	Compression string
+
+	// Filter, when set, limits the output to domains (including the TLD
+	// suffix) for which it returns true.
+	Filter func(domain string) bool
+
+	// SLDOnly reduces every owner name to its second-level label, so that
+	// e.g. the glue name ns1.example.com is counted as example.com.
+	SLDOnly bool
+
+	// TLD is the apex of the zone, such as "org", appended to every
+	// domain; "com" when empty.
+	TLD string
+}
+
+// suffix returns the suffix appended to the domains of the zone.
+func (opts Options) suffix() string {
+	if len(opts.TLD) == 0 {
+		return ".com"
+	}
+	return "." + strings.ToLower(opts.TLD)
+}
+
+// apex returns the owner name of the zone apex, such as "com.".
+func (opts Options) apex() string {
+	return opts.suffix()[1:] + "."
+}
+
+// sortFunc returns the domains with suffix appended, sorted as they are
+// written: "a-b.com" sorts before "a.com" although "a" sorts before "a-b",
+// and the merge of spilled batches relies on the written order.
+func sortFunc(domains *map[string]struct{}, suffix string) (sd *[]string) {
 	// sort domains
 	sortedDomains := make([]string, len(*domains))
 	i := 0
 	for domain := range *domains {
-		sortedDomains[i] = domain
+		sortedDomains[i] = domain + suffix
 		i++
 	}
 	sort.Strings(sortedDomains)
 	return &sortedDomains
 }
 
-func writeResults(gzw *gzip.Writer, domains *map[string]struct{}) {
-	sortedDomains := sortFunc(domains)
+func shardFor(domain string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// sld returns the second-level label of an owner name whose zone suffix
+// has already been stripped, e.g. "example" for "ns1.example".
+func sld(domain string) string {
+	return domain[strings.LastIndexByte(domain, '.')+1:]
+}
+
+// writeResults writes domains with suffix appended to ws, in insertion order
+// when order is non-nil and sorted otherwise. With several writers each
+// domain goes to writer hash(domain) % len(ws).
+func writeResults(ws []io.Writer, domains *map[string]struct{}, order []string, suffix string) error {
+	sortedDomains := &order
+	if order == nil {
+		// sortFunc appends the suffix itself
+		sortedDomains, suffix = sortFunc(domains, suffix), ""
+	}
 	for _, k := range *sortedDomains {
-		gzw.Write([]byte(k + ".com\n"))
+		domain := k + suffix
+		w := ws[0]
+		if len(ws) > 1 {
+			w = ws[shardFor(domain, len(ws))]
+		}
+		if _, err := w.Write([]byte(domain + "\n")); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func Parse(filepath string) (soa string, count uint) {
-	stream, err := os.Open(filepath)
-	if err != nil {
-		log.Printf("ERR: %s not found; skipping", filepath)
-		return "---", uint(0)
+// spillRun writes the sorted domains to a new temporary file per shard in
+// tempDir and appends the file names to runs.
+func spillRun(tempDir string, domains *map[string]struct{}, runs [][]string, suffix string) error {
+	files := make([]*os.File, len(runs))
+	bufs := make([]*bufio.Writer, len(runs))
+	ws := make([]io.Writer, len(runs))
+	for i := range runs {
+		f, err := os.CreateTemp(tempDir, "comparse-run-*")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		runs[i] = append(runs[i], f.Name())
+		files[i] = f
+		bufs[i] = bufio.NewWriter(f)
+		ws[i] = bufs[i]
+	}
+	if err := writeResults(ws, domains, nil, suffix); err != nil {
+		return err
+	}
+	for i := range files {
+		if err := bufs[i].Flush(); err != nil {
+			return err
+		}
+		if err := files[i].Close(); err != nil {
+			return err
+		}
 	}
-	defer stream.Close()
+	return nil
+}
 
-	gz, err := gzip.NewReader(stream)
-	if err != nil {
-		log.Fatal(err)
+// lineDomain returns the domain of an NS or A record line, without the TLD
+// suffix, if it passes opts.
+func lineDomain(line string, opts Options) (string, bool) {
+	if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+		// no owner name; the line continues the previous owner
+		return "", false
+	}
+	tokens := strings.Fields(line)
+	// owner [ttl] [class] type rdata, as in CZDS files; the TTL and class
+	// may come in either order
+	i := 1
+	for ; i < len(tokens) && i < 3; i++ {
+		if !isTTL(tokens[i]) && !isClass(tokens[i]) {
+			break
+		}
+	}
+	if len(tokens) > i+1 && (strings.ToLower(tokens[i]) == "ns" || strings.ToLower(tokens[i]) == "a") {
+		// some files spell out owners as "example.com"; strip the suffix
+		// so they deduplicate with the relative "example"
+		domain := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(tokens[0]), "."), opts.suffix())
+		if domain == opts.suffix()[1:] || domain == "@" {
+			// the apex's own NS records
+			return "", false
+		}
+		if opts.SLDOnly {
+			domain = sld(domain)
+		}
+		if opts.Filter == nil || opts.Filter(domain+opts.suffix()) {
+			return domain, true
+		}
 	}
-	defer gz.Close()
+	return "", false
+}
 
-	outputFile, err := os.Create(strings.TrimSuffix(filepath, ".gz") + "_domains.gz")
-	if err != nil {
-		log.Fatal(err)
+// isTTL reports whether token is a TTL in seconds.
+func isTTL(token string) bool {
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+	return len(token) > 0
+}
+
+// isClass reports whether token is a DNS class.
+func isClass(token string) bool {
+	switch strings.ToUpper(token) {
+	case "IN", "CH", "HS", "CS":
+		return true
+	}
+	return false
+}
+
+// StreamingParse is like Parse but writes each domain as soon as it is seen,
+// using constant memory. The output is unsorted and only consecutive
+// repeats, such as the NS records of one delegation, are removed; count is
+// the number of lines written. With SLDOnly a domain is therefore written
+// again for each run of its names, e.g. for glue such as ns1.example.com
+// that follows other delegations. PreserveOrder, TempDir, ShardCount and
+// Compression are ignored.
+func StreamingParse(r io.Reader, w io.Writer, opts Options) (soa string, serial uint32, count uint, err error) {
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	var soaLine soaParser
+	last := ""
+	for scanner.Scan() {
+		if soaLine.line(scanner.Text()) && soaLine.err != nil {
+			return "", 0, 0, soaLine.err
+		}
+		domain, ok := lineDomain(scanner.Text(), opts)
+		if !ok || (count > 0 && domain == last) {
+			continue
+		}
+		if _, err := bw.WriteString(domain + opts.suffix() + "\n"); err != nil {
+			return "", 0, 0, err
+		}
+		last = domain
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, 0, err
 	}
+	if err := bw.Flush(); err != nil {
+		return "", 0, 0, err
+	}
+	soa, serial = soaLine.result(opts)
+	return soa, serial, count, nil
+}
 
-	gzw := gzip.NewWriter(outputFile)
-	defer gzw.Close()
+// Parse reads the (uncompressed) com zone from r and writes its domains to
+// w, one per line. soa and serial are those of the zone's SOA record, or the
+// apex of opts.TLD and 0 if it has none.
+func Parse(r io.Reader, w io.Writer, opts Options) (soa string, serial uint32, count uint, err error) {
+	return ParseShards(r, []io.Writer{w}, opts)
+}
 
+// ParseShards is like Parse but splits the domains over ws: each domain goes
+// to ws[hash(domain) % len(ws)].
+func ParseShards(r io.Reader, ws []io.Writer, opts Options) (soa string, serial uint32, count uint, err error) {
 	domains := make(map[string]struct{})
 	len_domains := 0
 
-	scanner := bufio.NewScanner(gz)
+	var order []string
+	if opts.PreserveOrder {
+		order = make([]string, 0)
+	}
+
+	// Sorted batches are spilled to temporary runs per writer and merged at
+	// the end, so a domain seen in several batches is written once. With
+	// PreserveOrder batches are written as they are.
+	runs := make([][]string, len(ws))
+	spilled := false
+	defer func() {
+		for _, files := range runs {
+			for _, name := range files {
+				os.Remove(name)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	var soaLine soaParser
 	line_count := 0
 
 	for scanner.Scan() {
-		if line_count > 50000000 { // 50M
+		if line_count > batchLines {
 			// sort & store
-			writeResults(gzw, &domains)
-			len_domains = len_domains + len(domains)
+			if order != nil {
+				if err := writeResults(ws, &domains, order, opts.suffix()); err != nil {
+					return "", 0, 0, err
+				}
+				len_domains = len_domains + len(domains)
+			} else {
+				if err := spillRun(opts.TempDir, &domains, runs, opts.suffix()); err != nil {
+					return "", 0, 0, err
+				}
+				spilled = true
+			}
 
 			// clear map
 			// compiler optimizes as of Go 1.11+
 			for k := range domains {
 				delete(domains, k)
 			}
+			if order != nil {
+				order = order[:0]
+			}
 			//reset
 			line_count = 0
 		}
-		tokens := strings.Split(scanner.Text(), " ")
-		if len(tokens) > 2 && len(tokens[0]) > 0 && (strings.ToLower(tokens[1]) == "ns" || strings.ToLower(tokens[1]) == "a") {
-			domains[strings.ToLower(tokens[0])] = struct{}{}
+		if soaLine.line(scanner.Text()) && soaLine.err != nil {
+			return "", 0, 0, soaLine.err
+		}
+		if domain, ok := lineDomain(scanner.Text(), opts); ok {
+			if order != nil {
+				if _, seen := domains[domain]; !seen {
+					order = append(order, domain)
+				}
+			}
+			domains[domain] = struct{}{}
 		}
 		line_count++
 	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, 0, err
+	}
+
 	// sort & store final
-	writeResults(gzw, &domains)
-	len_domains = len_domains + len(domains)
-	return "com.", uint(len_domains)
+	if spilled {
+		if err := spillRun(opts.TempDir, &domains, runs, opts.suffix()); err != nil {
+			return "", 0, 0, err
+		}
+		for i := range ws {
+			n, err := mergeSorted(runs[i], ws[i])
+			if err != nil {
+				return "", 0, 0, err
+			}
+			len_domains = len_domains + int(n)
+		}
+	} else {
+		if err := writeResults(ws, &domains, order, opts.suffix()); err != nil {
+			return "", 0, 0, err
+		}
+		len_domains = len_domains + len(domains)
+	}
+
+	soa, serial = soaLine.result(opts)
+	return soa, serial, uint(len_domains), nil
+}
+
+// OutputFiles returns the files ParseFile writes for output: output itself,
+// or with opts.ShardCount > 1 the shards <base>_shard_0<ext> and on, where
+// output is <base><ext> and ext the extension of opts.Compression.
+func OutputFiles(output string, opts Options) []string {
+	if opts.ShardCount <= 1 {
+		return []string{output}
+	}
+	ext := compression.Extension(opts.Compression)
+	base := strings.TrimSuffix(output, ext)
+	files := make([]string, opts.ShardCount)
+	for i := range files {
+		files[i] = fmt.Sprintf("%s_shard_%d%s", base, i, ext)
+	}
+	return files
+}
+
+// ParseFile is like ParseShards but writes the files named by OutputFiles,
+// compressed per opts.Compression. They are written in opts.TempDir and
+// renamed into place once all are complete; on error none are left behind.
+func ParseFile(r io.Reader, output string, opts Options) (soa string, serial uint32, count uint, err error) {
+	if len(opts.TempDir) == 0 {
+		opts.TempDir = filepath.Dir(output)
+	}
+	names := OutputFiles(output, opts)
+	files := make([]*atomicfile.File, len(names))
+	cws := make([]io.WriteCloser, len(names))
+	ws := make([]io.Writer, len(names))
+	for i, name := range names {
+		f, err := atomicfile.CreateIn(opts.TempDir, name)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		defer f.Abort()
+		files[i] = f
+
+		if cws[i], err = compression.NewWriter(f, opts.Compression); err != nil {
+			return "", 0, 0, err
+		}
+		ws[i] = cws[i]
+	}
+
+	soa, serial, count, err = ParseShards(r, ws, opts)
+	for _, w := range cws {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return "", 0, 0, err
+	}
+	for _, f := range files {
+		if err := f.Commit(); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	return soa, serial, count, nil
 }
@@ -0,0 +1,321 @@
+package comparse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zf-analysis/compression"
+)
+
+// parsers are the entry points that share the comparse line handling.
+var parsers = map[string]func(io.Reader, io.Writer, Options) (string, uint32, uint, error){
+	"Parse":          Parse,
+	"StreamingParse": StreamingParse,
+}
+
+func TestParseSOA(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		zone    string
+		tld     string
+		soa     string
+		serial  uint32
+		wantErr bool
+	}{
+		{
+			name:   "one line",
+			zone:   "com. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1700000000 1800 900 604800 86400\nexample NS ns1.example\n",
+			soa:    "com.",
+			serial: 1700000000,
+		},
+		{
+			name:   "multi-line",
+			zone:   "org. 3600 IN SOA a0.org.afilias-nst.info. noc.afilias-nst.info. (\n 2012345678 ; serial\n 1800 900 604800 86400 )\nexample NS ns1.example\n",
+			tld:    "org",
+			soa:    "org.",
+			serial: 2012345678,
+		},
+		{
+			name: "no SOA",
+			zone: "example NS ns1.example\n",
+			tld:  "net",
+			soa:  "net.",
+		},
+		{
+			name:    "bad serial",
+			zone:    "com. IN SOA a. b. serial 1 2 3 4\n",
+			wantErr: true,
+		},
+	} {
+		for name, parse := range parsers {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				var out bytes.Buffer
+				soa, serial, count, err := parse(strings.NewReader(tc.zone), &out, Options{TLD: tc.tld})
+				if (err != nil) != tc.wantErr {
+					t.Fatalf("err = %v, want error %t", err, tc.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if soa != tc.soa || serial != tc.serial || count != 1 {
+					t.Errorf("got %s %d with %d domains, want %s %d with 1", soa, serial, count, tc.soa, tc.serial)
+				}
+			})
+		}
+	}
+}
+
+func TestLineDomain(t *testing.T) {
+	for _, tc := range []struct {
+		line   string
+		domain string
+		ok     bool
+	}{
+		{line: "example NS ns1.example", domain: "example", ok: true},
+		{line: "example.com.\t172800\tin\tns\tns1.example.com.", domain: "example", ok: true},
+		{line: "example 172800 IN A 192.0.2.1", domain: "example", ok: true},
+		{line: "example IN 172800 NS ns1.example", domain: "example", ok: true},
+		{line: "example IN NS", ok: false},
+		{line: "example 172800 IN DS 1 8 2 abcd", ok: false},
+		{line: "example 172800 IN TXT ns", ok: false},
+		{line: "\t172800 IN NS ns2.example", ok: false},
+		{line: "com. 172800 IN NS a.gtld-servers.net.", ok: false},
+		{line: "COM 172800 IN NS a.gtld-servers.net.", ok: false},
+		{line: "@ 172800 IN NS a.gtld-servers.net.", ok: false},
+	} {
+		domain, ok := lineDomain(tc.line, Options{})
+		if domain != tc.domain || ok != tc.ok {
+			t.Errorf("lineDomain(%q) = %q, %t; want %q, %t", tc.line, domain, ok, tc.domain, tc.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		zone  string
+		opts  Options
+		batch int // batchLines, when set
+		out   string
+	}{
+		{
+			name: "sorted and deduplicated",
+			zone: "b NS x\nz NS x\na NS x\nb NS y\nz A 192.0.2.1\nc DS 1 8 2 ab\n",
+			out:  "a.com\nb.com\nz.com\n",
+		},
+		{
+			name:  "deduplicated across batches",
+			zone:  "b NS x\nz NS x\na NS x\nb NS y\nc NS x\nz A 192.0.2.1\n",
+			batch: 2,
+			out:   "a.com\nb.com\nc.com\nz.com\n",
+		},
+		{
+			name: "sorted with the suffix",
+			zone: "ab NS x\na NS x\na-b NS x\n",
+			out:  "a-b.com\na.com\nab.com\n",
+		},
+		{
+			name:  "sorted with the suffix across batches",
+			zone:  "ab NS x\na NS x\na-b NS x\na NS y\nab NS y\na-b NS y\n",
+			batch: 2,
+			out:   "a-b.com\na.com\nab.com\n",
+		},
+		{
+			name: "preserve order",
+			zone: "b NS x\nz NS x\na NS x\nb NS y\n",
+			opts: Options{PreserveOrder: true},
+			out:  "b.com\nz.com\na.com\n",
+		},
+		{
+			name: "spelled-out owners",
+			zone: "example NS a\nEXAMPLE.COM NS b\nexample.com. NS c\nns1.other.com NS d\n",
+			out:  "example.com\nns1.other.com\n",
+		},
+		{
+			name: "sld only",
+			zone: "ns1.other.com NS d\nns1.other NS d\nexample NS a\n",
+			opts: Options{SLDOnly: true},
+			out:  "example.com\nother.com\n",
+		},
+		{
+			name: "filter",
+			zone: "example NS a\nother NS a\n",
+			opts: Options{Filter: func(domain string) bool { return domain != "other.com" }},
+			out:  "example.com\n",
+		},
+		{
+			name: "tld",
+			zone: "org. NS a0.org.afilias-nst.info.\nexample NS a\nEXAMPLE.ORG. NS b\n",
+			opts: Options{TLD: "org"},
+			out:  "example.org\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.batch != 0 {
+				defer func(n int) { batchLines = n }(batchLines)
+				batchLines = tc.batch
+			}
+			dir := t.TempDir()
+			tc.opts.TempDir = dir
+
+			var out bytes.Buffer
+			_, _, count, err := Parse(strings.NewReader(tc.zone), &out, tc.opts)
+			if err != nil || out.String() != tc.out || int(count) != strings.Count(tc.out, "\n") {
+				t.Errorf("got %q (count %d), %v; want %q", out.String(), count, err, tc.out)
+			}
+			if runs, _ := os.ReadDir(dir); len(runs) != 0 {
+				t.Errorf("%d temporary runs left behind", len(runs))
+			}
+		})
+	}
+}
+
+func TestStreamingParse(t *testing.T) {
+	var out bytes.Buffer
+	_, _, count, err := StreamingParse(strings.NewReader("b NS x\nb NS y\nz NS x\nb A 192.0.2.1\n"), &out, Options{})
+	if want := "b.com\nz.com\nb.com\n"; err != nil || out.String() != want || count != 3 {
+		t.Errorf("got %q (count %d), %v; want %q", out.String(), count, err, want)
+	}
+	out.Reset()
+	_, _, count, err = StreamingParse(strings.NewReader("b NS x\nns1.b NS y\nz NS x\nns1.b A 192.0.2.1\n"), &out, Options{SLDOnly: true})
+	if want := "b.com\nz.com\nb.com\n"; err != nil || out.String() != want || count != 3 {
+		t.Errorf("SLDOnly: got %q (count %d), %v; want %q", out.String(), count, err, want)
+	}
+}
+
+func TestParseShards(t *testing.T) {
+	var zone strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&zone, "d%d NS ns1.d%d\n", i, i)
+	}
+	ws := make([]io.Writer, 3)
+	bufs := make([]*bytes.Buffer, len(ws))
+	for i := range ws {
+		bufs[i] = new(bytes.Buffer)
+		ws[i] = bufs[i]
+	}
+	_, _, count, err := ParseShards(strings.NewReader(zone.String()), ws, Options{TempDir: t.TempDir()})
+	if err != nil || count != 100 {
+		t.Fatalf("count %d, %v", count, err)
+	}
+	seen := make(map[string]bool)
+	for i, buf := range bufs {
+		for _, domain := range strings.Fields(buf.String()) {
+			if seen[domain] || shardFor(domain, len(ws)) != i {
+				t.Errorf("%s is duplicated or in the wrong shard %d", domain, i)
+			}
+			seen[domain] = true
+		}
+	}
+	if len(seen) != 100 {
+		t.Errorf("got %d domains, want 100", len(seen))
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  Options
+		files []string
+	}{
+		{name: "one file", files: []string{"com_domains.gz"}},
+		{name: "shards", opts: Options{ShardCount: 2}, files: []string{"com_domains_shard_0.gz", "com_domains_shard_1.gz"}},
+		{name: "plain shards", opts: Options{ShardCount: 2, Compression: compression.None}, files: []string{"com_domains_shard_0.txt", "com_domains_shard_1.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			output := filepath.Join(dir, "com_domains"+compression.Extension(tc.opts.Compression))
+			_, _, count, err := ParseFile(strings.NewReader("a NS x\nb NS x\nc NS x\nd NS x\n"), output, tc.opts)
+			if err != nil || count != 4 {
+				t.Fatalf("count %d, %v", count, err)
+			}
+
+			var got []string
+			for _, name := range OutputFiles(output, tc.opts) {
+				if filepath.Dir(name) != dir {
+					t.Errorf("%s is outside %s", name, dir)
+				}
+				got = append(got, filepath.Base(name))
+			}
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if strings.Join(got, ",") != strings.Join(tc.files, ",") || strings.Join(names, ",") != strings.Join(tc.files, ",") {
+				t.Errorf("OutputFiles %v, wrote %v; want %v", got, names, tc.files)
+			}
+		})
+	}
+}
+
+func TestParseSOAOnly(t *testing.T) {
+	for _, tc := range []struct {
+		zone    string
+		soa     string
+		serial  uint32
+		wantErr bool
+	}{
+		{
+			zone:   "; c\ncom. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. (\n 1712345678 ; serial\n 1800 900 604800 86400)\nx NS y\n",
+			soa:    "com.",
+			serial: 1712345678,
+		},
+		{zone: "org. soa a. b. 7 1 2 3 4\n", soa: "org.", serial: 7},
+		{zone: "com. IN SOA a. b. (\n", wantErr: true},
+		{zone: "x NS y\n", wantErr: true},
+		{zone: "com. IN SOA a. b. -1 1 2 3 4\n", wantErr: true},
+	} {
+		soa, serial, err := ParseSOAOnly(strings.NewReader(tc.zone))
+		if (err != nil) != tc.wantErr || (err == nil && (soa != tc.soa || serial != tc.serial)) {
+			t.Errorf("%q: got %s %d, %v", tc.zone, soa, serial, err)
+		}
+	}
+}
+
+// BenchmarkComparse measures Parse on a 1M-line com zone in the CZDS layout.
+// Run it with
+//
+//	go test ./zoneparse/comparse -run '^$' -bench=BenchmarkComparse -benchmem
+//
+// Baseline (Go 1.27, one Xeon core): about 1.7 s/op and 27 MB/s, with 330 MB
+
+// BenchmarkComparse measures Parse on a 1M-line com zone in the CZDS layout.
+// Run it with
+//
+//	go test ./zoneparse/comparse -run '^$' -bench=BenchmarkComparse -benchmem
+//
+// Baseline (Go 1.27, one Xeon core): about 1.7 s/op and 27 MB/s, with 330 MB
+// allocated per op.
+func BenchmarkComparse(b *testing.B) {
+	const lines = 1000000
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	buf.WriteString("com.\t900\tin\tsoa\ta.gtld-servers.net.\tnstld.verisign-grs.com.\t1700000000\t1800\t900\t604800\t86400\n")
+	for i := 1; i < lines; i++ {
+		// delegations with two nameservers and some glue
+		name := fmt.Sprintf("d%x.com.", rng.Uint32())
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&buf, "ns1.%s\t172800\tin\ta\t192.0.2.%d\n", name, rng.Intn(256))
+		default:
+			fmt.Fprintf(&buf, "%s\t172800\tin\tns\tns%d.%s\n", name, i%3, name)
+		}
+	}
+	zone := buf.Bytes()
+	opts := Options{TempDir: b.TempDir()}
+	b.SetBytes(int64(len(zone)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := Parse(bytes.NewReader(zone), io.Discard, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package comparse
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"os"
+
+	"zf-analysis/compression"
+)
+
+type mergeSource struct {
+	scanner *bufio.Scanner
+	line    string
+}
+
+// mergeQueue is a min-heap of sources ordered by their current line.
+type mergeQueue []*mergeSource
+
+func (q mergeQueue) Len() int            { return len(q) }
+func (q mergeQueue) Less(i, j int) bool  { return q[i].line < q[j].line }
+func (q mergeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *mergeQueue) Push(x interface{}) { *q = append(*q, x.(*mergeSource)) }
+func (q *mergeQueue) Pop() interface{} {
+	old := *q
+	src := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return src
+}
+
+// MergeResults k-way merges the sorted domain lists in files (e.g. the
+// outputs of Parse for several zones, compressed or not) into output,
+// writing each domain once.
+func MergeResults(files []string, output io.Writer) error {
+	_, err := mergeSorted(files, output)
+	return err
+}
+
+// mergeSorted is MergeResults, also returning the number of lines written.
+func mergeSorted(files []string, output io.Writer) (uint, error) {
+	var queue mergeQueue
+	for _, file := range files {
+		stream, err := os.Open(file)
+		if err != nil {
+			return 0, err
+		}
+		defer stream.Close()
+
+		gz, err := compression.Open(stream)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+
+		src := &mergeSource{scanner: bufio.NewScanner(gz)}
+		if src.scanner.Scan() {
+			src.line = src.scanner.Text()
+			queue = append(queue, src)
+		} else if err := src.scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+	heap.Init(&queue)
+
+	w := bufio.NewWriter(output)
+	last := ""
+	var count uint
+	for queue.Len() > 0 {
+		src := queue[0]
+		if count == 0 || src.line != last {
+			if _, err := w.WriteString(src.line + "\n"); err != nil {
+				return count, err
+			}
+			last = src.line
+			count++
+		}
+
+		if src.scanner.Scan() {
+			src.line = src.scanner.Text()
+			heap.Fix(&queue, 0)
+			continue
+		}
+		if err := src.scanner.Err(); err != nil {
+			return count, err
+		}
+		heap.Pop(&queue)
+	}
+
+	return count, w.Flush()
+}
@@ -0,0 +1,57 @@
+package comparse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "a")
+	if err := os.WriteFile(plain, []byte("a.com\nc.com\ne.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("b.com\nc.com\nf.com\n"))
+	w.Close()
+	compressed := filepath.Join(dir, "b.gz")
+	if err := os.WriteFile(compressed, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := MergeResults([]string{plain, compressed}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.com\nb.com\nc.com\ne.com\nf.com\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestMergeParseOutput(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i, zone := range []string{
+		"ab NS x\na NS x\nc NS x\n",
+		"a-b NS x\na NS x\nab NS x\n",
+	} {
+		path := filepath.Join(dir, []string{"a.gz", "b.gz"}[i])
+		if _, _, _, err := ParseFile(strings.NewReader(zone), path, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	var out bytes.Buffer
+	if err := MergeResults(files, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a-b.com\na.com\nab.com\nc.com\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
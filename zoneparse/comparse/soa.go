@@ -0,0 +1,97 @@
+package comparse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// soaParser picks the first SOA record out of the lines of a zone.
+type soaParser struct {
+	soa    string
+	serial uint32
+	fields []string // SOA RDATA collected so far
+	found  bool     // the SOA record has started
+	done   bool     // serial is set, or err
+	err    error
+}
+
+// line feeds the next line of the zone to p, returning true once the SOA
+// serial has been read or found invalid.
+func (p *soaParser) line(line string) bool {
+	if p.done {
+		return true
+	}
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	tokens := strings.Fields(line)
+
+	if !p.found {
+		// owner [ttl] [class] SOA ...
+		for i := 1; i < len(tokens) && i <= 3; i++ {
+			if strings.ToUpper(tokens[i]) == "SOA" {
+				p.soa = tokens[0]
+				tokens = tokens[i+1:]
+				p.found = true
+				break
+			}
+		}
+		if !p.found {
+			return false
+		}
+	}
+
+	for _, token := range tokens {
+		if token != "(" && token != ")" {
+			p.fields = append(p.fields, strings.Trim(token, "()"))
+		}
+	}
+	// MNAME RNAME SERIAL
+	if len(p.fields) >= 3 {
+		u, err := strconv.ParseUint(p.fields[2], 10, 32)
+		if err != nil {
+			p.err = fmt.Errorf("invalid SOA serial '%s'", p.fields[2])
+		}
+		p.serial = uint32(u)
+		p.done = true
+	}
+	return p.done
+}
+
+// result returns the SOA owner name and serial p has read, or the apex of
+// opts with serial 0 when the zone has no SOA record.
+func (p *soaParser) result(opts Options) (string, uint32) {
+	if !p.found {
+		return opts.apex(), 0
+	}
+	return p.soa, p.serial
+}
+
+// ParseSOAOnly reads r up to the first SOA record and returns its owner name
+// and serial, without parsing the rest of the zone. The SOA may span several
+// lines using parentheses.
+func ParseSOAOnly(r io.Reader) (soa string, serial uint32, err error) {
+	scanner := bufio.NewScanner(r)
+
+	var p soaParser
+	for scanner.Scan() {
+		if p.line(scanner.Text()) {
+			if p.err != nil {
+				return p.soa, 0, p.err
+			}
+			return p.soa, p.serial, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, err
+	}
+
+	if p.found {
+		return p.soa, 0, errors.New("incomplete SOA record")
+	}
+	return "", 0, errors.New("no SOA record found")
+}
@@ -0,0 +1,213 @@
+package zoneparse
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// KeyTag computes the key tag of key (RFC 4034 appendix B).
+func (key DNSKEYRecord) KeyTag() uint16 {
+	wire := make([]byte, 4, 4+len(key.PublicKey))
+	binary.BigEndian.PutUint16(wire, key.Flags)
+	wire[2] = key.Protocol
+	wire[3] = key.Algorithm
+	wire = append(wire, key.PublicKey...)
+
+	var ac uint32
+	for i, b := range wire {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+	return uint16(ac & 0xFFFF)
+}
+
+// VerifyRRSIG verifies sig over rrset with key, following RFC 4034 section 6
+// for the signed data. Supported algorithms are RSA (5, 7, 8, 10), ECDSA
+// (13, 14) and Ed25519 (15). The validity period is not checked, so archived
+// zones can be verified after their signatures expired.
+func VerifyRRSIG(rrset []Record, sig RRSIGRecord, key DNSKEYRecord) error {
+	if len(rrset) == 0 {
+		return errors.New("empty RRset")
+	}
+	if key.Algorithm != sig.Algorithm {
+		return fmt.Errorf("key algorithm %d does not match signature algorithm %d", key.Algorithm, sig.Algorithm)
+	}
+	if tag := key.KeyTag(); tag != sig.KeyTag {
+		return fmt.Errorf("key tag %d does not match signature key tag %d", tag, sig.KeyTag)
+	}
+
+	signed, err := signedData(rrset, sig)
+	if err != nil {
+		return err
+	}
+
+	switch sig.Algorithm {
+	case 5, 7:
+		return verifyRSA(key.PublicKey, crypto.SHA1, signed, sig.Signature)
+	case 8:
+		return verifyRSA(key.PublicKey, crypto.SHA256, signed, sig.Signature)
+	case 10:
+		return verifyRSA(key.PublicKey, crypto.SHA512, signed, sig.Signature)
+	case 13:
+		return verifyECDSA(key.PublicKey, elliptic.P256(), crypto.SHA256, signed, sig.Signature)
+	case 14:
+		return verifyECDSA(key.PublicKey, elliptic.P384(), crypto.SHA384, signed, sig.Signature)
+	case 15:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("invalid Ed25519 public key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.PublicKey), signed, sig.Signature) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported DNSSEC algorithm %d", sig.Algorithm)
+}
+
+// signedData builds the data covered by sig: the RRSIG RDATA without the
+// signature followed by the RRset in canonical form and order.
+func signedData(rrset []Record, sig RRSIGRecord) ([]byte, error) {
+	covered, err := typeCode(sig.TypeCovered)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := packName(sig.SignerName)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 18, 18+len(signer))
+	binary.BigEndian.PutUint16(data, covered)
+	data[2] = sig.Algorithm
+	data[3] = sig.Labels
+	binary.BigEndian.PutUint32(data[4:], sig.OriginalTTL)
+	binary.BigEndian.PutUint32(data[8:], sig.Expiration)
+	binary.BigEndian.PutUint32(data[12:], sig.Inception)
+	binary.BigEndian.PutUint16(data[16:], sig.KeyTag)
+	data = append(data, signer...)
+
+	for _, r := range SortRRset(rrset) {
+		if r.Type != sig.TypeCovered {
+			return nil, fmt.Errorf("%s record in RRset covered by %s signature", r.Type, sig.TypeCovered)
+		}
+
+		owner, err := packName(signedOwner(r.DomainName, sig.Labels))
+		if err != nil {
+			return nil, err
+		}
+		rdata, err := packRdata(r)
+		if err != nil {
+			return nil, err
+		}
+
+		class := r.Class
+		if class == RecordClass_UNKNOWN {
+			class = RecordClass_IN
+		}
+
+		header := make([]byte, 10)
+		binary.BigEndian.PutUint16(header, covered)
+		binary.BigEndian.PutUint16(header[2:], uint16(class))
+		binary.BigEndian.PutUint32(header[4:], sig.OriginalTTL)
+		binary.BigEndian.PutUint16(header[8:], uint16(len(rdata)))
+
+		data = append(data, owner...)
+		data = append(data, header...)
+		data = append(data, rdata...)
+	}
+
+	return data, nil
+}
+
+// signedOwner returns the owner name as signed: names with more labels than
+// the signature's label count were synthesized from a wildcard
+// (RFC 4035 section 5.3.2).
+func signedOwner(name string, labels uint8) string {
+	trimmed := strings.TrimSuffix(name, ".")
+	if len(trimmed) == 0 {
+		return name
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if parts[0] == "*" {
+		parts = parts[1:]
+	}
+	if len(parts) <= int(labels) {
+		return name
+	}
+	return "*." + strings.Join(parts[len(parts)-int(labels):], ".")
+}
+
+func verifyRSA(keyData []byte, hash crypto.Hash, signed, signature []byte) error {
+	if len(keyData) < 3 {
+		return errors.New("invalid RSA public key")
+	}
+
+	expLen := int(keyData[0])
+	keyData = keyData[1:]
+	if expLen == 0 {
+		expLen = int(binary.BigEndian.Uint16(keyData))
+		keyData = keyData[2:]
+	}
+	if expLen == 0 || len(keyData) <= expLen {
+		return errors.New("invalid RSA public key")
+	}
+
+	exp := new(big.Int).SetBytes(keyData[:expLen])
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return errors.New("unsupported RSA exponent")
+	}
+	pub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(keyData[expLen:]),
+		E: int(exp.Int64()),
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature); err != nil {
+		return fmt.Errorf("signature verification failed: %s", err)
+	}
+	return nil
+}
+
+func verifyECDSA(keyData []byte, curve elliptic.Curve, hash crypto.Hash, signed, signature []byte) error {
+	size := (curve.Params().BitSize + 7) / 8
+	if len(keyData) != 2*size {
+		return errors.New("invalid ECDSA public key")
+	}
+	if len(signature) != 2*size {
+		return errors.New("invalid ECDSA signature")
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(keyData[:size]),
+		Y:     new(big.Int).SetBytes(keyData[size:]),
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package zoneparse
+
+import "testing"
+
+// The Ed25519 example of RFC 8080 section 6.1.
+const ed25519Zone = `example.com. 3600 IN DNSKEY 257 3 15 ( l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4= )
+example.com. 3600 IN MX 10 mail.example.com.
+example.com. 3600 IN RRSIG MX 15 2 3600 ( 1440021600 1438207200 3613 example.com. oL9krJun7xfBOIWcGHi7mag5/hdZrKWw15jPGrHpjQeRAvTdszaPD+QLs3fx8A4M3e23mRZ9VrbpMngwcrqNAg== )
+`
+
+func TestVerifyRRSIG(t *testing.T) {
+	records, err := ParseBytes([]byte(ed25519Zone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := records[0].AsDNSKEY()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyTag() != 3613 || !key.IsKSK() || AlgorithmName(key.Algorithm) != "Ed25519" {
+		t.Errorf("key tag %d, KSK %t, algorithm %s", key.KeyTag(), key.IsKSK(), AlgorithmName(key.Algorithm))
+	}
+	sig, err := records[2].AsRRSIG()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(mx *Record, sig *RRSIGRecord)
+		ok     bool
+	}{
+		{name: "valid", modify: func(*Record, *RRSIGRecord) {}, ok: true},
+		{name: "owner case", modify: func(mx *Record, _ *RRSIGRecord) { mx.DomainName = "EXAMPLE.com." }, ok: true},
+		{name: "data", modify: func(mx *Record, _ *RRSIGRecord) { mx.Data[0] = "20" }},
+		{name: "key tag", modify: func(_ *Record, sig *RRSIGRecord) { sig.KeyTag++ }},
+		{name: "type covered", modify: func(_ *Record, sig *RRSIGRecord) { sig.TypeCovered = RecordType_A }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mx, s := records[1].Clone(), *sig
+			tc.modify(&mx, &s)
+			if err := VerifyRRSIG([]Record{mx}, s, *key); (err == nil) != tc.ok {
+				t.Errorf("VerifyRRSIG = %v, want ok %t", err, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package zoneparse
+
+import (
+	"encoding/json"
+)
+
+// jsonRecord is the JSON form of a Record.
+type jsonRecord struct {
+	Name    string   `json:"name"`
+	TTL     *int64   `json:"ttl,omitempty"`
+	Class   string   `json:"class,omitempty"`
+	Type    string   `json:"type"`
+	Data    []string `json:"data"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+// MarshalJSON encodes r as an object with the fields name, ttl, class, type,
+// data and comment. ttl, class and comment are omitted when unset.
+func (r Record) MarshalJSON() ([]byte, error) {
+	jr := jsonRecord{
+		Name:    r.DomainName,
+		Type:    r.Type.String(),
+		Data:    r.Data,
+		Comment: r.Comment,
+	}
+	if r.TimeToLive >= 0 {
+		jr.TTL = &r.TimeToLive
+	}
+	if r.Class != RecordClass_UNKNOWN {
+		jr.Class = r.Class.String()
+	}
+	if jr.Data == nil {
+		jr.Data = []string{}
+	}
+	return json.Marshal(jr)
+}
+
+// UnmarshalJSON decodes a record in the form written by MarshalJSON.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var jr jsonRecord
+	if err := json.Unmarshal(data, &jr); err != nil {
+		return err
+	}
+
+	record := Record{
+		DomainName: jr.Name,
+		TimeToLive: -1,
+		Data:       jr.Data,
+		Comment:    jr.Comment,
+	}
+	if jr.TTL != nil {
+		record.TimeToLive = *jr.TTL
+	}
+	if len(jr.Class) != 0 {
+		class, err := parseClass(jr.Class)
+		if err != nil {
+			return err
+		}
+		record.Class = class
+	}
+	// MarshalJSON writes "[UNKNOWN]" for records without a type
+	if jr.Type != "[UNKNOWN]" {
+		rt, err := parseType(jr.Type)
+		if err != nil {
+			return err
+		}
+		record.Type = rt
+	}
+
+	*r = record
+	return nil
+}
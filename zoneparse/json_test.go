@@ -0,0 +1,47 @@
+package zoneparse
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecordJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		record Record
+		json   string
+	}{
+		{
+			name:   "full",
+			record: Record{DomainName: "a.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_A, Data: []string{"192.0.2.1"}, Comment: "; x"},
+			json:   `{"name":"a.","ttl":300,"class":"IN","type":"A","data":["192.0.2.1"],"comment":"; x"}`,
+		},
+		{
+			name:   "unset ttl and class",
+			record: Record{DomainName: "a.", TimeToLive: -1, Type: RecordType_MX, Data: []string{"10", "mail"}},
+			json:   `{"name":"a.","type":"MX","data":["10","mail"]}`,
+		},
+		{
+			name:   "unknown type",
+			record: Record{DomainName: "a.", TimeToLive: 0, Data: []string{}},
+			json:   `{"name":"a.","ttl":0,"type":"[UNKNOWN]","data":[]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.record)
+			if err != nil || string(data) != tc.json {
+				t.Fatalf("got %s, %v; want %s", data, err, tc.json)
+			}
+			var record Record
+			if err := json.Unmarshal(data, &record); err != nil || !reflect.DeepEqual(record, tc.record) {
+				t.Errorf("read back as %+v, %v; want %+v", record, err, tc.record)
+			}
+		})
+	}
+
+	var record Record
+	if err := json.Unmarshal([]byte(`{"name":"a.","type":"BOGUS","data":[]}`), &record); err == nil {
+		t.Error("unknown type name accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package zoneparse
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// maxConcurrentOpens bounds how many zone files NewMultiZoneParser opens and
+// primes at the same time.
+const maxConcurrentOpens = 8
+
+type zoneSource struct {
+	path    string
+	file    *os.File
+	scanner *Scanner
+	record  Record
+	err     error
+}
+
+func (z *zoneSource) advance() error {
+	z.err = z.scanner.Next(&z.record)
+	return z.err
+}
+
+// terminal reports whether the source's last error ended its scan, unlike a
+// parse error after which scanning resumes.
+func (z *zoneSource) terminal() bool {
+	return z.err == ErrTooManyErrors || z.scanner.Err() != nil
+}
+
+// sourceQueue is a min-heap of sources ordered by their current record's DomainName.
+type sourceQueue []*zoneSource
+
+func (q sourceQueue) Len() int            { return len(q) }
+func (q sourceQueue) Less(i, j int) bool  { return q[i].record.DomainName < q[j].record.DomainName }
+func (q sourceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *sourceQueue) Push(x interface{}) { *q = append(*q, x.(*zoneSource)) }
+func (q *sourceQueue) Pop() interface{} {
+	old := *q
+	z := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return z
+}
+
+// MultiZoneParser presents several zone files as a single record stream.
+// Records are merged by DomainName; owner names present in several zones are
+// emitted once per zone.
+type MultiZoneParser struct {
+	sources []*zoneSource
+	queue   sourceQueue
+	failed  []*zoneSource
+}
+
+func NewMultiZoneParser(paths []string, opts ...ScannerOption) (*MultiZoneParser, error) {
+	m := &MultiZoneParser{
+		sources: make([]*zoneSource, len(paths)),
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentOpens)
+	openErrs := make([]error, len(paths))
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			file, err := os.Open(path)
+			if err != nil {
+				openErrs[i] = err
+				return
+			}
+			z := &zoneSource{
+				path:    path,
+				file:    file,
+				scanner: NewScanner(file, opts...),
+			}
+			_ = z.advance()
+			m.sources[i] = z
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range openErrs {
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	for _, z := range m.sources {
+		m.requeue(z)
+	}
+
+	return m, nil
+}
+
+// requeue places z according to the outcome of its last advance. Exhausted
+// sources are dropped and their scanner closed.
+func (m *MultiZoneParser) requeue(z *zoneSource) {
+	switch z.err {
+	case nil:
+		heap.Push(&m.queue, z)
+	case io.EOF:
+		z.scanner.Close()
+	default:
+		m.failed = append(m.failed, z)
+	}
+}
+
+// Next stores the record with the lowest DomainName across all zones in
+// outrecord. Parse errors are returned prefixed with the zone file path;
+// scanning of that zone resumes on the following call, as with Scanner.Next.
+// After a read error or ErrTooManyErrors the zone is dropped.
+func (m *MultiZoneParser) Next(outrecord *Record) error {
+	if len(m.failed) > 0 {
+		z := m.failed[0]
+		m.failed = m.failed[1:]
+		err := z.err
+		if z.terminal() {
+			z.scanner.Close()
+		} else {
+			_ = z.advance()
+			m.requeue(z)
+		}
+		return fmt.Errorf("%s: %s", z.path, err)
+	}
+
+	if m.queue.Len() == 0 {
+		return io.EOF
+	}
+
+	z := heap.Pop(&m.queue).(*zoneSource)
+	*outrecord = z.record
+	z.record = Record{}
+	_ = z.advance()
+	m.requeue(z)
+	return nil
+}
+
+// Close closes all scanners and underlying zone files.
+func (m *MultiZoneParser) Close() error {
+	var firstErr error
+	for _, z := range m.sources {
+		if z == nil {
+			continue
+		}
+		z.scanner.Close()
+		if err := z.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,93 @@
+package zoneparse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiZoneParser(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(strings.Repeat("e. IN A 192.0.2.1\n", 1000)))
+	w.Close()
+	truncated := gz.String()[:gz.Len()/2]
+
+	for _, tc := range []struct {
+		name    string
+		zones   []string
+		opts    []ScannerOption
+		domains string
+		errs    int
+	}{
+		{
+			name:    "merged",
+			zones:   []string{"b. IN A 192.0.2.1\nd. IN A 192.0.2.1\n", "a. IN A 192.0.2.1\nc. IN A 192.0.2.1\n"},
+			domains: "a.,b.,c.,d.",
+		},
+		{
+			name:    "parse error resumes",
+			zones:   []string{"b. IN A 192.0.2.1\nbad. IN A\nd. IN A 192.0.2.1\n", "a. IN A 192.0.2.1\n"},
+			domains: "a.,b.,d.",
+			errs:    1,
+		},
+		{
+			name:    "too many errors drops zone",
+			zones:   []string{"bad. IN A\nbad. IN A\nd. IN A 192.0.2.1\n", "a. IN A 192.0.2.1\n"},
+			opts:    []ScannerOption{WithMaxErrors(1)},
+			domains: "a.",
+			errs:    2,
+		},
+		{
+			name:    "read error drops zone",
+			zones:   []string{truncated, "a. IN A 192.0.2.1\n"},
+			domains: "a.",
+			errs:    1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for i, zone := range tc.zones {
+				path := filepath.Join(dir, string(rune('a'+i)))
+				if err := os.WriteFile(path, []byte(zone), 0644); err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+
+			m, err := NewMultiZoneParser(paths, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			var domains []string
+			var errs int
+			for i := 0; ; i++ {
+				if i == 100000 {
+					t.Fatal("no io.EOF")
+				}
+				var record Record
+				err := m.Next(&record)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					errs++
+					continue
+				}
+				if record.DomainName != "e." {
+					domains = append(domains, record.DomainName)
+				}
+			}
+			if got := strings.Join(domains, ","); got != tc.domains || errs != tc.errs {
+				t.Errorf("got %s with %d errors, want %s with %d", got, errs, tc.domains, tc.errs)
+			}
+		})
+	}
+}
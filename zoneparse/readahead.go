@@ -0,0 +1,75 @@
+package zoneparse
+
+import "io"
+
+// readAheadChunkSize caps the size of the chunks passed from the read-ahead
+// goroutine to the scanner.
+const readAheadChunkSize = 64 * 1024
+
+// readAheadReader reads from its source in a background goroutine so that
+// I/O overlaps with tokenizing.
+type readAheadReader struct {
+	chunks chan []byte
+	done   chan struct{}
+	buf    []byte
+	err    error // set before chunks is closed
+}
+
+func newReadAheadReader(src io.Reader, bufferBytes int) *readAheadReader {
+	chunkSize := readAheadChunkSize
+	if bufferBytes < chunkSize {
+		chunkSize = bufferBytes
+	}
+
+	r := &readAheadReader{
+		chunks: make(chan []byte, bufferBytes/chunkSize),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.chunks)
+		for {
+			chunk := make([]byte, chunkSize)
+			n, err := src.Read(chunk)
+			if n > 0 {
+				select {
+				case r.chunks <- chunk[:n]:
+				case <-r.done:
+					return
+				}
+			}
+			if err != nil {
+				r.err = err
+				return
+			}
+		}
+	}()
+
+	return r
+}
+
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			if r.err == nil {
+				return 0, io.EOF
+			}
+			return 0, r.err
+		}
+		r.buf = chunk
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// stop makes the background goroutine exit once its current read returns.
+func (r *readAheadReader) stop() {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+}
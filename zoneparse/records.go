@@ -0,0 +1,552 @@
+package zoneparse
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Typed views of record RDATA. Each AsXXX method checks the record type and
+// the number of Data tokens before parsing the individual fields.
+
+// HINFORecord holds HINFO RDATA (RFC 1035 section 3.3.2) without quotes.
+type HINFORecord struct {
+	CPU string
+	OS  string
+}
+
+// MXRecord holds MX RDATA (RFC 1035 section 3.3.9).
+type MXRecord struct {
+	Priority uint16
+	Exchange string
+}
+
+// NAPTRRecord holds NAPTR RDATA (RFC 3403). Flags, Service and Regexp are
+// stored without their surrounding quotes; escapes are left as written.
+type NAPTRRecord struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// RRSIGRecord holds RRSIG RDATA (RFC 4034 section 3.1). Expiration and
+// Inception are seconds since the epoch.
+type RRSIGRecord struct {
+	TypeCovered RecordType
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+// SOARecord holds SOA RDATA (RFC 1035 section 3.3.13).
+type SOARecord struct {
+	MasterNS           string
+	ResponsibleMailbox string
+	Serial             uint32
+	Refresh            uint32
+	Retry              uint32
+	Expire             uint32
+	Minimum            uint32
+}
+
+// SRVRecord holds SRV RDATA (RFC 2782).
+type SRVRecord struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// NoService reports whether the record states that the service is not
+// available (RFC 2782 target ".").
+func (srv SRVRecord) NoService() bool {
+	return srv.Target == "."
+}
+
+// SSHFPRecord holds SSHFP RDATA (RFC 4255). Algorithm is the SSH key
+// algorithm (1 RSA, 2 DSA, 3 ECDSA, 4 Ed25519, ...).
+type SSHFPRecord struct {
+	Algorithm       uint8
+	FingerprintType uint8
+	Fingerprint     []byte
+}
+
+// fingerprintLengths maps SSHFP fingerprint types to their size in bytes.
+var fingerprintLengths = map[uint8]int{
+	1: 20, // SHA-1
+	2: 32, // SHA-256
+}
+
+// URIRecord holds URI RDATA (RFC 7553). Target is stored without quotes.
+type URIRecord struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// DSRecord holds DS RDATA (RFC 4034 section 5.1).
+type DSRecord struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// digestLengths maps DS digest types to their digest size in bytes.
+var digestLengths = map[uint8]int{
+	1: 20, // SHA-1
+	2: 32, // SHA-256
+	4: 48, // SHA-384
+}
+
+// CDSRecord is the child-side copy of a DS record (RFC 7344). The delete
+// signal "0 0 0 00" parses to a zero DigestType and a single zero byte Digest.
+type CDSRecord DSRecord
+
+// DNSKEYRecord holds DNSKEY RDATA (RFC 4034 section 2.1).
+type DNSKEYRecord struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+// IsKSK reports whether the Secure Entry Point flag, set on key signing
+// keys, is present.
+func (key DNSKEYRecord) IsKSK() bool {
+	return key.Flags&0x0001 != 0
+}
+
+// algorithmNames maps DNSSEC algorithm numbers to their names, following
+// the IANA DNS Security Algorithm Numbers registry.
+var algorithmNames = map[uint8]string{
+	1:   "RSA/MD5",
+	3:   "DSA/SHA-1",
+	5:   "RSA/SHA-1",
+	6:   "DSA-NSEC3-SHA1",
+	7:   "RSASHA1-NSEC3-SHA1",
+	8:   "RSA/SHA-256",
+	10:  "RSA/SHA-512",
+	12:  "GOST R 34.10-2001",
+	13:  "ECDSA P-256",
+	14:  "ECDSA P-384",
+	15:  "Ed25519",
+	16:  "Ed448",
+	252: "INDIRECT",
+	253: "PRIVATEDNS",
+	254: "PRIVATEOID",
+}
+
+// AlgorithmName returns the name of DNSSEC algorithm id, as used in DNSKEY,
+// RRSIG and DS records, or "unassigned" for unknown numbers.
+func AlgorithmName(id uint8) string {
+	if name, ok := algorithmNames[id]; ok {
+		return name
+	}
+	return "unassigned"
+}
+
+// CDNSKEYRecord is the child-side copy of a DNSKEY record (RFC 7344).
+type CDNSKEYRecord DNSKEYRecord
+
+// OPENPGPKEYRecord holds the decoded key material of an OPENPGPKEY record (RFC 7929).
+type OPENPGPKEYRecord struct {
+	KeyData []byte
+}
+
+// rdata returns the Data tokens of r without the grouping parentheses of
+// multi-line records, after checking the record type and that there are at
+// least min and, when max > 0, at most max tokens.
+func (r Record) rdata(rt RecordType, min, max int) ([]string, error) {
+	if r.Type != rt {
+		return nil, fmt.Errorf("record for %s is %s, not %s", r.DomainName, r.Type, rt)
+	}
+
+	data := make([]string, 0, len(r.Data))
+	for _, token := range r.Data {
+		if token != "(" && token != ")" {
+			data = append(data, token)
+		}
+	}
+
+	if len(data) < min || (max > 0 && len(data) > max) {
+		expected := fmt.Sprintf("at least %d", min)
+		if min == max {
+			expected = fmt.Sprintf("%d", min)
+		}
+		return nil, fmt.Errorf("%s record for %s has %d data fields, expected %s",
+			r.Type,
+			r.DomainName,
+			len(data),
+			expected,
+		)
+	}
+	return data, nil
+}
+
+func parseUint8(field, token string) (uint8, error) {
+	u, err := strconv.ParseUint(token, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", field, token)
+	}
+	return uint8(u), nil
+}
+
+func parseUint32(field, token string) (uint32, error) {
+	u, err := strconv.ParseUint(token, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", field, token)
+	}
+	return uint32(u), nil
+}
+
+func parseUint16(field, token string) (uint16, error) {
+	u, err := strconv.ParseUint(token, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", field, token)
+	}
+	return uint16(u), nil
+}
+
+// unquote strips the surrounding double quotes kept by the Scanner on
+// string tokens. Unquoted tokens are returned unchanged.
+func unquote(token string) string {
+	if len(token) >= 2 && token[0] == '"' && token[len(token)-1] == '"' {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+func (r Record) AsHINFO() (*HINFORecord, error) {
+	data, err := r.rdata(RecordType_HINFO, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HINFORecord{
+		CPU: unquote(data[0]),
+		OS:  unquote(data[1]),
+	}, nil
+}
+
+// AsMX parses MX RDATA. A null MX (RFC 7505) has Exchange ".".
+func (r Record) AsMX() (*MXRecord, error) {
+	data, err := r.rdata(RecordType_MX, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var mx MXRecord
+	if mx.Priority, err = parseUint16("priority", data[0]); err != nil {
+		return nil, err
+	}
+	mx.Exchange = data[1]
+
+	return &mx, nil
+}
+
+func (r Record) AsNAPTR() (*NAPTRRecord, error) {
+	data, err := r.rdata(RecordType_NAPTR, 6, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	var naptr NAPTRRecord
+	if naptr.Order, err = parseUint16("order", data[0]); err != nil {
+		return nil, err
+	}
+	if naptr.Preference, err = parseUint16("preference", data[1]); err != nil {
+		return nil, err
+	}
+	naptr.Flags = unquote(data[2])
+	naptr.Service = unquote(data[3])
+	naptr.Regexp = unquote(data[4])
+	naptr.Replacement = data[5]
+
+	return &naptr, nil
+}
+
+func (r Record) AsRRSIG() (*RRSIGRecord, error) {
+	data, err := r.rdata(RecordType_RRSIG, 9, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig RRSIGRecord
+	if sig.TypeCovered, err = parseType(data[0]); err != nil {
+		return nil, err
+	}
+	if sig.Algorithm, err = parseUint8("algorithm", data[1]); err != nil {
+		return nil, err
+	}
+	if sig.Labels, err = parseUint8("labels", data[2]); err != nil {
+		return nil, err
+	}
+	if sig.OriginalTTL, err = parseUint32("original TTL", data[3]); err != nil {
+		return nil, err
+	}
+	if sig.Expiration, err = parseSigTime("expiration", data[4]); err != nil {
+		return nil, err
+	}
+	if sig.Inception, err = parseSigTime("inception", data[5]); err != nil {
+		return nil, err
+	}
+	if sig.KeyTag, err = parseUint16("key tag", data[6]); err != nil {
+		return nil, err
+	}
+	sig.SignerName = data[7]
+	if sig.Signature, err = base64.StdEncoding.DecodeString(strings.Join(data[8:], "")); err != nil {
+		return nil, fmt.Errorf("invalid signature for %s: %s", r.DomainName, err)
+	}
+
+	return &sig, nil
+}
+
+// parseSigTime parses an RRSIG timestamp, written either as YYYYMMDDHHmmSS
+// or as seconds since the epoch (RFC 4034 section 3.2).
+func parseSigTime(field, token string) (uint32, error) {
+	if len(token) == 14 {
+		t, err := time.Parse("20060102150405", token)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s '%s'", field, token)
+		}
+		return uint32(t.Unix()), nil
+	}
+	return parseUint32(field, token)
+}
+
+func (r Record) AsSOA() (*SOARecord, error) {
+	data, err := r.rdata(RecordType_SOA, 7, 7)
+	if err != nil {
+		return nil, err
+	}
+
+	soa := SOARecord{
+		MasterNS:           data[0],
+		ResponsibleMailbox: data[1],
+	}
+	fields := []struct {
+		name string
+		dst  *uint32
+	}{
+		{"serial", &soa.Serial},
+		{"refresh", &soa.Refresh},
+		{"retry", &soa.Retry},
+		{"expire", &soa.Expire},
+		{"minimum", &soa.Minimum},
+	}
+	for i, field := range fields {
+		if *field.dst, err = parseUint32(field.name, data[i+2]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &soa, nil
+}
+
+func (r Record) AsSRV() (*SRVRecord, error) {
+	data, err := r.rdata(RecordType_SRV, 4, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	var srv SRVRecord
+	if srv.Priority, err = parseUint16("priority", data[0]); err != nil {
+		return nil, err
+	}
+	if srv.Weight, err = parseUint16("weight", data[1]); err != nil {
+		return nil, err
+	}
+	if srv.Port, err = parseUint16("port", data[2]); err != nil {
+		return nil, err
+	}
+	srv.Target = data[3]
+	if srv.Port == 0 && !srv.NoService() {
+		return nil, fmt.Errorf("invalid port 0 for %s target %s", r.DomainName, srv.Target)
+	}
+
+	return &srv, nil
+}
+
+func (r Record) AsSSHFP() (*SSHFPRecord, error) {
+	data, err := r.rdata(RecordType_SSHFP, 3, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var fp SSHFPRecord
+	if fp.Algorithm, err = parseUint8("algorithm", data[0]); err != nil {
+		return nil, err
+	}
+	if fp.FingerprintType, err = parseUint8("fingerprint type", data[1]); err != nil {
+		return nil, err
+	}
+	if fp.Fingerprint, err = hex.DecodeString(strings.Join(data[2:], "")); err != nil {
+		return nil, fmt.Errorf("invalid fingerprint for %s: %s", r.DomainName, err)
+	}
+
+	if want, ok := fingerprintLengths[fp.FingerprintType]; ok && len(fp.Fingerprint) != want {
+		return nil, fmt.Errorf("fingerprint for %s is %d bytes, fingerprint type %d requires %d",
+			r.DomainName,
+			len(fp.Fingerprint),
+			fp.FingerprintType,
+			want,
+		)
+	}
+
+	return &fp, nil
+}
+
+func (r Record) AsURI() (*URIRecord, error) {
+	data, err := r.rdata(RecordType_URI, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	var uri URIRecord
+	if uri.Priority, err = parseUint16("priority", data[0]); err != nil {
+		return nil, err
+	}
+	if uri.Weight, err = parseUint16("weight", data[1]); err != nil {
+		return nil, err
+	}
+	uri.Target = unquote(data[2])
+	if len(strings.TrimSpace(uri.Target)) == 0 {
+		return nil, fmt.Errorf("empty URI target for %s", r.DomainName)
+	}
+
+	return &uri, nil
+}
+
+func (r Record) AsDS() (*DSRecord, error) {
+	data, err := r.rdata(RecordType_DS, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := parseDSData(r.DomainName, data)
+	if err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+func (r Record) AsCDS() (*CDSRecord, error) {
+	data, err := r.rdata(RecordType_CDS, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := parseDSData(r.DomainName, data)
+	if err != nil {
+		return nil, err
+	}
+	cds := CDSRecord(ds)
+	return &cds, nil
+}
+
+// parseDSData parses the DS RDATA layout shared with CDS. The digest length
+// is checked for the known digest types only.
+func parseDSData(name string, data []string) (DSRecord, error) {
+	var ds DSRecord
+	var err error
+	if ds.KeyTag, err = parseUint16("key tag", data[0]); err != nil {
+		return ds, err
+	}
+	if ds.Algorithm, err = parseUint8("algorithm", data[1]); err != nil {
+		return ds, err
+	}
+	if ds.DigestType, err = parseUint8("digest type", data[2]); err != nil {
+		return ds, err
+	}
+	if ds.Digest, err = hex.DecodeString(strings.Join(data[3:], "")); err != nil {
+		return ds, fmt.Errorf("invalid digest for %s: %s", name, err)
+	}
+
+	if want, ok := digestLengths[ds.DigestType]; ok && len(ds.Digest) != want {
+		return ds, fmt.Errorf("digest for %s is %d bytes, digest type %d requires %d",
+			name,
+			len(ds.Digest),
+			ds.DigestType,
+			want,
+		)
+	}
+
+	return ds, nil
+}
+
+func (r Record) AsDNSKEY() (*DNSKEYRecord, error) {
+	data, err := r.rdata(RecordType_DNSKEY, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseDNSKEYData(r.DomainName, data)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r Record) AsCDNSKEY() (*CDNSKEYRecord, error) {
+	data, err := r.rdata(RecordType_CDNSKEY, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseDNSKEYData(r.DomainName, data)
+	if err != nil {
+		return nil, err
+	}
+	cdnskey := CDNSKEYRecord(key)
+	return &cdnskey, nil
+}
+
+// parseDNSKEYData parses the DNSKEY RDATA layout shared with CDNSKEY. The
+// base64 key may be split over several tokens.
+func parseDNSKEYData(name string, data []string) (DNSKEYRecord, error) {
+	var key DNSKEYRecord
+	var err error
+	if key.Flags, err = parseUint16("flags", data[0]); err != nil {
+		return key, err
+	}
+	if key.Protocol, err = parseUint8("protocol", data[1]); err != nil {
+		return key, err
+	}
+	if key.Protocol != 3 {
+		return key, fmt.Errorf("invalid protocol %d for %s, must be 3", key.Protocol, name)
+	}
+	if key.Algorithm, err = parseUint8("algorithm", data[2]); err != nil {
+		return key, err
+	}
+	if key.PublicKey, err = base64.StdEncoding.DecodeString(strings.Join(data[3:], "")); err != nil {
+		return key, fmt.Errorf("invalid public key for %s: %s", name, err)
+	}
+
+	return key, nil
+}
+
+func (r Record) AsOPENPGPKEY() (*OPENPGPKEYRecord, error) {
+	data, err := r.rdata(RecordType_OPENPGPKEY, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	keyData, err := base64.StdEncoding.DecodeString(strings.Join(data, ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key data for %s: %s", r.DomainName, err)
+	}
+
+	return &OPENPGPKEYRecord{KeyData: keyData}, nil
+}
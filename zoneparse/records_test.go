@@ -0,0 +1,245 @@
+package zoneparse
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustParseLine returns the record on line.
+func mustParseLine(t *testing.T, line string) Record {
+	t.Helper()
+	record, complete, err := ParsePartialLine(line)
+	if err != nil || !complete {
+		t.Fatalf("%q: complete %t, %v", line, complete, err)
+	}
+	return record
+}
+
+func TestRecordParsers(t *testing.T) {
+	digest := bytes.Repeat([]byte{0xab}, 32)
+	hexDigest := strings.Repeat("ab", 32)
+
+	for _, tc := range []struct {
+		line  string
+		parse func(Record) (interface{}, error)
+		want  interface{} // nil for an error
+	}{
+		{
+			line:  "_http._tcp.a. IN URI 10 1 \"https://a.example/\"",
+			parse: func(r Record) (interface{}, error) { return r.AsURI() },
+			want:  &URIRecord{Priority: 10, Weight: 1, Target: "https://a.example/"},
+		},
+		{
+			line:  "_http._tcp.a. IN URI 10 1 \"\"",
+			parse: func(r Record) (interface{}, error) { return r.AsURI() },
+		},
+		{
+			line:  "a. IN CDS 0 0 0 00",
+			parse: func(r Record) (interface{}, error) { return r.AsCDS() },
+			want:  &CDSRecord{Digest: []byte{0}},
+		},
+		{
+			line:  "a. IN CDNSKEY 257 3 13 q8 0=",
+			parse: func(r Record) (interface{}, error) { return r.AsCDNSKEY() },
+			want:  &CDNSKEYRecord{Flags: 257, Protocol: 3, Algorithm: 13, PublicKey: []byte{0xab, 0xcd}},
+		},
+		{
+			line:  "a. IN OPENPGPKEY q8 0=",
+			parse: func(r Record) (interface{}, error) { return r.AsOPENPGPKEY() },
+			want:  &OPENPGPKEYRecord{KeyData: []byte{0xab, 0xcd}},
+		},
+		{
+			line:  "a. IN OPENPGPKEY not!base64",
+			parse: func(r Record) (interface{}, error) { return r.AsOPENPGPKEY() },
+		},
+		{
+			line:  "a. IN SOA ns1.a. hostmaster.a. ( 2024010101 7200 3600 1209600 300 )",
+			parse: func(r Record) (interface{}, error) { return r.AsSOA() },
+			want:  &SOARecord{MasterNS: "ns1.a.", ResponsibleMailbox: "hostmaster.a.", Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300},
+		},
+		{
+			line:  "a. IN SOA ns1.a. hostmaster.a. 4294967296 7200 3600 1209600 300",
+			parse: func(r Record) (interface{}, error) { return r.AsSOA() },
+		},
+		{
+			line:  "a. IN MX 10 mail.a.",
+			parse: func(r Record) (interface{}, error) { return r.AsMX() },
+			want:  &MXRecord{Priority: 10, Exchange: "mail.a."},
+		},
+		{
+			line:  "a. IN MX 0 .",
+			parse: func(r Record) (interface{}, error) { return r.AsMX() },
+			want:  &MXRecord{Exchange: "."},
+		},
+		{
+			line:  "a. IN MX 65536 mail.a.",
+			parse: func(r Record) (interface{}, error) { return r.AsMX() },
+		},
+		{
+			line:  "a. IN MX 10",
+			parse: func(r Record) (interface{}, error) { return r.AsMX() },
+		},
+		{
+			line:  "a. IN A 192.0.2.1",
+			parse: func(r Record) (interface{}, error) { return r.AsMX() },
+		},
+		{
+			line:  "_sip._tcp.a. IN SRV 10 60 5060 sip.a.",
+			parse: func(r Record) (interface{}, error) { return r.AsSRV() },
+			want:  &SRVRecord{Priority: 10, Weight: 60, Port: 5060, Target: "sip.a."},
+		},
+		{
+			line:  "_sip._tcp.a. IN SRV 0 0 0 .",
+			parse: func(r Record) (interface{}, error) { return r.AsSRV() },
+			want:  &SRVRecord{Target: "."},
+		},
+		{
+			line:  "_sip._tcp.a. IN SRV 10 60 0 sip.a.",
+			parse: func(r Record) (interface{}, error) { return r.AsSRV() },
+		},
+		{
+			line:  "a. IN DNSKEY 257 3 13 ( q80= )",
+			parse: func(r Record) (interface{}, error) { return r.AsDNSKEY() },
+			want:  &DNSKEYRecord{Flags: 257, Protocol: 3, Algorithm: 13, PublicKey: []byte{0xab, 0xcd}},
+		},
+		{
+			line:  "a. IN DNSKEY 256 2 13 q80=",
+			parse: func(r Record) (interface{}, error) { return r.AsDNSKEY() },
+		},
+		{
+			line:  "a. IN DS 12345 8 2 " + hexDigest[:32] + " " + hexDigest[32:],
+			parse: func(r Record) (interface{}, error) { return r.AsDS() },
+			want:  &DSRecord{KeyTag: 12345, Algorithm: 8, DigestType: 2, Digest: digest},
+		},
+		{
+			line:  "a. IN DS 12345 8 2 abcd",
+			parse: func(r Record) (interface{}, error) { return r.AsDS() },
+		},
+		{
+			line:  "a. IN SSHFP 4 2 " + hexDigest,
+			parse: func(r Record) (interface{}, error) { return r.AsSSHFP() },
+			want:  &SSHFPRecord{Algorithm: 4, FingerprintType: 2, Fingerprint: digest},
+		},
+		{
+			line:  "a. IN SSHFP 4 1 " + hexDigest,
+			parse: func(r Record) (interface{}, error) { return r.AsSSHFP() },
+		},
+		{
+			line:  "a. IN NAPTR 100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.a.",
+			parse: func(r Record) (interface{}, error) { return r.AsNAPTR() },
+			want:  &NAPTRRecord{Order: 100, Preference: 10, Flags: "S", Service: "SIP+D2U", Replacement: "_sip._udp.a."},
+		},
+		{
+			line:  "a. IN HINFO \"INTEL-386\" \"Linux\"",
+			parse: func(r Record) (interface{}, error) { return r.AsHINFO() },
+			want:  &HINFORecord{CPU: "INTEL-386", OS: "Linux"},
+		},
+	} {
+		got, err := tc.parse(mustParseLine(t, tc.line))
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%q: parsed as %+v, want an error", tc.line, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, %v; want %+v", tc.line, got, err, tc.want)
+		}
+	}
+}
+
+func TestAllRecordTypes(t *testing.T) {
+	if len(AllRecordTypes) != int(recordType_end)-1 {
+		t.Errorf("AllRecordTypes has %d types, want %d", len(AllRecordTypes), int(recordType_end)-1)
+	}
+	seen := make(map[RecordType]bool)
+	for _, rt := range AllRecordTypes {
+		if rt == RecordType_UNKNOWN || seen[rt] || rt.String() == "[UNKNOWN]" {
+			t.Errorf("AllRecordTypes lists %s twice or without a name", rt)
+		}
+		seen[rt] = true
+	}
+}
+
+func TestGenericRecordType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want RecordType
+	}{
+		{name: "TYPE1", want: RecordType_A},
+		{name: "type15", want: RecordType_MX},
+		{name: "TYPE65000", want: RecordType_Generic + 65000},
+	} {
+		if rt, ok := LookupType(tc.name); !ok || rt != tc.want {
+			t.Errorf("LookupType(%q) = %s, %t; want %s", tc.name, rt, ok, tc.want)
+		}
+	}
+	if rt := RecordType(RecordType_Generic + 65000); rt.String() != "TYPE65000" {
+		t.Errorf("String() = %s, want TYPE65000", rt)
+	}
+}
+
+func TestLookupType(t *testing.T) {
+	for _, name := range []string{"A", "MX", "RRSIG", "URI", "OPENPGPKEY", "CDNSKEY"} {
+		rt, ok := LookupType(strings.ToLower(name))
+		if !ok || rt.String() != name || RecordTypeNames[name] != rt {
+			t.Errorf("LookupType(%q) = %s, %t", name, rt, ok)
+		}
+	}
+	if _, ok := LookupType("BOGUS"); ok {
+		t.Error("LookupType accepted BOGUS")
+	}
+}
+
+func TestRecordTypeIsDNSSEC(t *testing.T) {
+	for rt, want := range map[RecordType]bool{
+		RecordType_A:       false,
+		RecordType_MX:      false,
+		RecordType_RRSIG:   true,
+		RecordType_DNSKEY:  true,
+		RecordType_CDNSKEY: true,
+		RecordType_NSEC3:   true,
+	} {
+		if rt.IsDNSSEC() != want {
+			t.Errorf("%s: IsDNSSEC %t, want %t", rt, rt.IsDNSSEC(), want)
+		}
+	}
+}
+
+func TestRecordTypePredicates(t *testing.T) {
+	for _, tc := range []struct {
+		rt       RecordType
+		mail     bool
+		obsolete bool
+	}{
+		{rt: RecordType_A},
+		{rt: RecordType_MX, mail: true},
+		{rt: RecordType_SPF, mail: true},
+		{rt: RecordType_MD, obsolete: true},
+		{rt: RecordType_RRSIG},
+	} {
+		if tc.rt.IsMailRelated() != tc.mail || tc.rt.IsObsolete() != tc.obsolete {
+			t.Errorf("%s: IsMailRelated %t, IsObsolete %t", tc.rt, tc.rt.IsMailRelated(), tc.rt.IsObsolete())
+		}
+	}
+}
+
+func TestRecordTypeNumber(t *testing.T) {
+	for name, number := range map[string]int{
+		"A":          1,
+		"MX":         15,
+		"SPF":        99,
+		"MD":         3,
+		"RRSIG":      46,
+		"URI":        256,
+		"OPENPGPKEY": 61,
+		"CDNSKEY":    60,
+	} {
+		rt, err := RecordTypeFromString(name)
+		if err != nil || rt.Number() != number || RecordTypeFromInt(number) != rt {
+			t.Errorf("%s: number %d, %v; want %d", name, rt.Number(), err, number)
+		}
+	}
+}
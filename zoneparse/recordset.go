@@ -0,0 +1,60 @@
+package zoneparse
+
+import (
+	"io"
+	"sort"
+)
+
+// RecordSet groups records by owner name. Names are compared
+// case-insensitively and without trailing dot.
+type RecordSet map[string][]Record
+
+// BuildRecordSet reads all records of src into a RecordSet. It stops at the
+// first parse error.
+func BuildRecordSet(src io.Reader, opts ...ScannerOption) (*RecordSet, error) {
+	s := NewScanner(src, opts...)
+	defer s.Close()
+
+	set := make(RecordSet)
+	var record Record
+	for {
+		if err := s.Next(&record); err != nil {
+			if err == io.EOF {
+				return &set, nil
+			}
+			return nil, err
+		}
+		set.Add(record)
+	}
+}
+
+func (set RecordSet) Add(r Record) {
+	name := canonicalName(r.DomainName)
+	set[name] = append(set[name], r)
+}
+
+// Get returns the records owned by name.
+func (set RecordSet) Get(name string) []Record {
+	return set[canonicalName(name)]
+}
+
+// GetOfType returns the records of type rt owned by name.
+func (set RecordSet) GetOfType(name string, rt RecordType) []Record {
+	var records []Record
+	for _, r := range set.Get(name) {
+		if r.Type == rt {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Names returns the owner names in the set, sorted.
+func (set RecordSet) Names() []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,369 @@
+package zoneparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RRsetKey identifies an RRset: all records sharing owner, class and type.
+type RRsetKey struct {
+	Owner string
+	Class RecordClass
+	Type  RecordType
+}
+
+// GroupByRRset groups records into RRsets. Owner names are compared
+// case-insensitively and are lower-cased in the keys.
+func GroupByRRset(records []Record) map[RRsetKey][]Record {
+	rrsets := make(map[RRsetKey][]Record)
+	for _, r := range records {
+		key := RRsetKey{
+			Owner: strings.ToLower(r.DomainName),
+			Class: r.Class,
+			Type:  r.Type,
+		}
+		rrsets[key] = append(rrsets[key], r)
+	}
+	return rrsets
+}
+
+// SortRRset returns a copy of rrs sorted in canonical order (RFC 4034
+// section 6.3), comparing the canonical wire format of each RDATA. Records
+// whose RDATA cannot be encoded sort by their textual Data instead.
+func SortRRset(rrs []Record) []Record {
+	type sortable struct {
+		record Record
+		wire   []byte
+	}
+
+	entries := make([]sortable, len(rrs))
+	for i, r := range rrs {
+		wire, err := packRdata(r)
+		if err != nil {
+			wire = []byte(strings.Join(r.Data, " "))
+		}
+		entries[i] = sortable{record: r, wire: wire}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].wire, entries[j].wire) < 0
+	})
+
+	sorted := make([]Record, len(entries))
+	for i, e := range entries {
+		sorted[i] = e.record
+	}
+	return sorted
+}
+
+// typeCodes maps record types to their IANA-assigned numbers.
+var typeCodes = map[RecordType]uint16{
+	RecordType_A:          1,
+	RecordType_NS:         2,
+	RecordType_MD:         3,
+	RecordType_MF:         4,
+	RecordType_CNAME:      5,
+	RecordType_SOA:        6,
+	RecordType_MB:         7,
+	RecordType_MG:         8,
+	RecordType_MR:         9,
+	RecordType_NULL:       10,
+	RecordType_WKS:        11,
+	RecordType_PTR:        12,
+	RecordType_HINFO:      13,
+	RecordType_MINFO:      14,
+	RecordType_MX:         15,
+	RecordType_TXT:        16,
+	RecordType_RP:         17,
+	RecordType_AFSDB:      18,
+	RecordType_AAAA:       28,
+	RecordType_LOC:        29,
+	RecordType_SRV:        33,
+	RecordType_NAPTR:      35,
+	RecordType_DS:         43,
+	RecordType_SSHFP:      44,
+	RecordType_RRSIG:      46,
+	RecordType_NSEC:       47,
+	RecordType_DNSKEY:     48,
+	RecordType_NSEC3:      50,
+	RecordType_NSEC3PARAM: 51,
+	RecordType_CDS:        59,
+	RecordType_CDNSKEY:    60,
+	RecordType_OPENPGPKEY: 61,
+	RecordType_SPF:        99,
+	RecordType_URI:        256,
+}
+
+// typesByCode is the inverse of typeCodes.
+var typesByCode = make(map[uint16]RecordType, len(typeCodes))
+
+func init() {
+	for rt, code := range typeCodes {
+		typesByCode[code] = rt
+	}
+}
+
+// RecordTypeFromString returns the record type named s, e.g. "MX" or
+// "TYPE65534", case-insensitively.
+func RecordTypeFromString(s string) (RecordType, error) {
+	return parseType(s)
+}
+
+// RecordTypeFromInt returns the record type with IANA number n. Numbers
+// without a constant of their own map to RecordType_Generic + n, and numbers
+// outside 0-65535 to RecordType_UNKNOWN.
+func RecordTypeFromInt(n int) RecordType {
+	if n < 0 || n > 0xffff {
+		return RecordType_UNKNOWN
+	}
+	if rt, ok := typesByCode[uint16(n)]; ok {
+		return rt
+	}
+	return RecordType(RecordType_Generic + n)
+}
+
+// Number returns the IANA number of rt, or 0 for RecordType_UNKNOWN.
+func (rt RecordType) Number() int {
+	code, _ := typeCode(rt)
+	return int(code)
+}
+
+// typeCode returns the IANA number of rt.
+func typeCode(rt RecordType) (uint16, error) {
+	if rt >= RecordType_Generic {
+		return uint16(rt - RecordType_Generic), nil
+	}
+	code, ok := typeCodes[rt]
+	if !ok {
+		return 0, fmt.Errorf("no type code for %s", rt)
+	}
+	return code, nil
+}
+
+// packName encodes name in uncompressed wire format, lower-cased as required
+// for canonical form. Names are treated as fully qualified.
+func packName(name string) ([]byte, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	var wire []byte
+	if len(name) != 0 {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid label in domain name '%s'", name)
+			}
+			wire = append(wire, byte(len(label)))
+			wire = append(wire, label...)
+		}
+	}
+	wire = append(wire, 0)
+
+	if len(wire) > 255 {
+		return nil, fmt.Errorf("domain name '%s' too long", name)
+	}
+	return wire, nil
+}
+
+// packString encodes a (possibly quoted) zone file token as a
+// <character-string>, resolving \X and \DDD escapes.
+func packString(token string) ([]byte, error) {
+	token = unquote(token)
+
+	var str []byte
+	for i := 0; i < len(token); i++ {
+		if token[i] != '\\' || i+1 == len(token) {
+			str = append(str, token[i])
+			continue
+		}
+
+		i++
+		if i+2 < len(token) && isDigits(token[i:i+3]) {
+			n, _ := strconv.Atoi(token[i : i+3])
+			if n > 255 {
+				return nil, fmt.Errorf("invalid escape in '%s'", token)
+			}
+			str = append(str, byte(n))
+			i += 2
+			continue
+		}
+		str = append(str, token[i])
+	}
+
+	if len(str) > 255 {
+		return nil, fmt.Errorf("character string too long: '%s'", token)
+	}
+	return append([]byte{byte(len(str))}, str...), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func packUint8(token string) ([]byte, error) {
+	u, err := parseUint8("field", token)
+	return []byte{u}, err
+}
+
+func packUint16(token string) ([]byte, error) {
+	u, err := parseUint16("field", token)
+	if err != nil {
+		return nil, err
+	}
+	wire := make([]byte, 2)
+	binary.BigEndian.PutUint16(wire, u)
+	return wire, nil
+}
+
+func packUint32(token string) ([]byte, error) {
+	u, err := parseUint32("field", token)
+	if err != nil {
+		return nil, err
+	}
+	wire := make([]byte, 4)
+	binary.BigEndian.PutUint32(wire, u)
+	return wire, nil
+}
+
+// rdataLayouts describes the RDATA of the supported types, field by field:
+// 'n' domain name, 'b' uint8, 's' uint16, 'l' uint32, 'c' character string,
+// 'C' one or more character strings, 'x' hex and '6' base64 taking all
+// remaining tokens.
+var rdataLayouts = map[RecordType]string{
+	RecordType_NS:         "n",
+	RecordType_MD:         "n",
+	RecordType_MF:         "n",
+	RecordType_CNAME:      "n",
+	RecordType_MB:         "n",
+	RecordType_MG:         "n",
+	RecordType_MR:         "n",
+	RecordType_PTR:        "n",
+	RecordType_MINFO:      "nn",
+	RecordType_RP:         "nn",
+	RecordType_MX:         "sn",
+	RecordType_AFSDB:      "sn",
+	RecordType_SOA:        "nnlllll",
+	RecordType_HINFO:      "cc",
+	RecordType_TXT:        "C",
+	RecordType_SPF:        "C",
+	RecordType_SRV:        "sssn",
+	RecordType_NAPTR:      "sscccn",
+	RecordType_DS:         "sbbx",
+	RecordType_CDS:        "sbbx",
+	RecordType_DNSKEY:     "sbb6",
+	RecordType_CDNSKEY:    "sbb6",
+	RecordType_SSHFP:      "bbx",
+	RecordType_OPENPGPKEY: "6",
+}
+
+// packRdata encodes the RDATA of r in canonical wire format (RFC 4034
+// section 6.2).
+func packRdata(r Record) ([]byte, error) {
+	data, err := r.rdata(r.Type, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Type {
+	case RecordType_A, RecordType_AAAA:
+		if len(data) != 1 {
+			return nil, fmt.Errorf("%s record for %s needs one address", r.Type, r.DomainName)
+		}
+		ip := net.ParseIP(data[0])
+		if r.Type == RecordType_A {
+			ip = ip.To4()
+		} else if ip.To4() != nil {
+			ip = nil
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("invalid %s address '%s'", r.Type, data[0])
+		}
+		return []byte(ip), nil
+	case RecordType_URI:
+		uri, err := r.AsURI()
+		if err != nil {
+			return nil, err
+		}
+		wire := make([]byte, 4, 4+len(uri.Target))
+		binary.BigEndian.PutUint16(wire, uri.Priority)
+		binary.BigEndian.PutUint16(wire[2:], uri.Weight)
+		return append(wire, uri.Target...), nil
+	}
+
+	if r.Type >= RecordType_Generic {
+		// RFC 3597: \# <length> <hex>
+		if len(data) < 2 || data[0] != "\\#" {
+			return nil, fmt.Errorf("%s record for %s is not in \\# form", r.Type, r.DomainName)
+		}
+		return hex.DecodeString(strings.Join(data[2:], ""))
+	}
+
+	layout, ok := rdataLayouts[r.Type]
+	if !ok {
+		return nil, fmt.Errorf("no wire format for %s records", r.Type)
+	}
+	return packLayout(r, layout, data)
+}
+
+func packLayout(r Record, layout string, data []string) ([]byte, error) {
+	var wire []byte
+	for i, field := range layout {
+		if i >= len(data) {
+			return nil, fmt.Errorf("%s record for %s is missing data fields", r.Type, r.DomainName)
+		}
+
+		var part []byte
+		var err error
+		switch field {
+		case 'n':
+			part, err = packName(data[i])
+		case 'b':
+			part, err = packUint8(data[i])
+		case 's':
+			part, err = packUint16(data[i])
+		case 'l':
+			part, err = packUint32(data[i])
+		case 'c':
+			part, err = packString(data[i])
+		case 'C':
+			for _, token := range data[i:] {
+				var str []byte
+				if str, err = packString(token); err != nil {
+					break
+				}
+				part = append(part, str...)
+			}
+		case 'x':
+			part, err = hex.DecodeString(strings.Join(data[i:], ""))
+		case '6':
+			part, err = base64.StdEncoding.DecodeString(strings.Join(data[i:], ""))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s record for %s: %s", r.Type, r.DomainName, err)
+		}
+		wire = append(wire, part...)
+
+		if field == 'C' || field == 'x' || field == '6' {
+			return wire, nil
+		}
+	}
+
+	if len(data) != len(layout) {
+		return nil, fmt.Errorf("%s record for %s has %d data fields, expected %d",
+			r.Type,
+			r.DomainName,
+			len(data),
+			len(layout),
+		)
+	}
+	return wire, nil
+}
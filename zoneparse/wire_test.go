@@ -0,0 +1,83 @@
+package zoneparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackRdata(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		wire string // empty for an error
+	}{
+		{line: "a. IN A 192.0.2.1", wire: "\xc0\x00\x02\x01"},
+		{line: "a. IN A 2001:db8::1"},
+		{line: "a. IN AAAA 2001:db8::1", wire: "\x20\x01\x0d\xb8" + strings.Repeat("\x00", 11) + "\x01"},
+		{line: "a. IN NS NS1.Example.", wire: "\x03ns1\x07example\x00"},
+		{line: "a. IN MX 10 mail.", wire: "\x00\x0a\x04mail\x00"},
+		{line: "a. IN TXT \"b\" \"\\065\"", wire: "\x01b\x01A"},
+		{line: "a. IN URI 1 2 \"x\"", wire: "\x00\x01\x00\x02x"},
+		{line: "a. IN TYPE65000 \\# 2 abcd", wire: "\xab\xcd"},
+		{line: "a. IN TYPE65000 abcd"},
+		{line: "a. IN MX 10"},
+	} {
+		got, err := packRdata(mustParseLine(t, tc.line))
+		if tc.wire == "" {
+			if err == nil {
+				t.Errorf("%q: packed as %q, want an error", tc.line, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != tc.wire {
+			t.Errorf("%q: got %q, %v; want %q", tc.line, got, err, tc.wire)
+		}
+	}
+}
+
+func TestRRsets(t *testing.T) {
+	records, err := ParseBytes([]byte(`a. IN A 192.0.2.2
+A. IN A 192.0.2.1
+a. IN MX 20 b.
+a. IN MX 10 z.
+a. CH A 192.0.2.3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rrsets := GroupByRRset(records)
+	for _, tc := range []struct {
+		key  RRsetKey
+		data []string // first Data token of each record in canonical order
+	}{
+		{key: RRsetKey{"a.", RecordClass_IN, RecordType_A}, data: []string{"192.0.2.1", "192.0.2.2"}},
+		{key: RRsetKey{"a.", RecordClass_IN, RecordType_MX}, data: []string{"10", "20"}},
+		{key: RRsetKey{"a.", RecordClass_CH, RecordType_A}, data: []string{"192.0.2.3"}},
+	} {
+		var got []string
+		for _, r := range SortRRset(rrsets[tc.key]) {
+			got = append(got, r.Data[0])
+		}
+		if strings.Join(got, ",") != strings.Join(tc.data, ",") {
+			t.Errorf("%v: got %v, want %v", tc.key, got, tc.data)
+		}
+	}
+	if len(rrsets) != 3 {
+		t.Errorf("got %d RRsets, want 3", len(rrsets))
+	}
+}
+
+func TestRecordSet(t *testing.T) {
+	set, err := BuildRecordSet(strings.NewReader("B. IN A 192.0.2.1\na. IN A 192.0.2.2\nb IN MX 10 mail.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(set.Names(), ","); names != "a,b" {
+		t.Errorf("Names() = %s, want a,b", names)
+	}
+	if n := len(set.Get("b.")); n != 2 {
+		t.Errorf("Get(b.) returned %d records, want 2", n)
+	}
+	if mx := set.GetOfType("B", RecordType_MX); len(mx) != 1 || mx[0].Data[1] != "mail." {
+		t.Errorf("GetOfType(B, MX) = %v", mx)
+	}
+}
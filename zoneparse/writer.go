@@ -0,0 +1,86 @@
+package zoneparse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writer writes records in zone file format, one per line with tab
+// separated fields. Records read by a Scanner are written in a form it reads
+// back into equal records.
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteRecord writes r. Owner names are written as given, and TTL and class
+// only when set. Data tokens that would not scan as a single token, such as
+// ones containing spaces, are quoted; a Scanner reads them back with the
+// quotes.
+func (zw *Writer) WriteRecord(r Record) error {
+	if len(r.DomainName) == 0 {
+		return fmt.Errorf("%s record has no owner name", r.Type)
+	}
+	if r.Type == RecordType_UNKNOWN {
+		return fmt.Errorf("record for %s has no type", r.DomainName)
+	}
+	if len(r.Data) == 0 {
+		return fmt.Errorf("%s record for %s has no data", r.Type, r.DomainName)
+	}
+
+	fields := []string{r.DomainName}
+	if r.TimeToLive >= 0 {
+		fields = append(fields, fmt.Sprintf("%d", r.TimeToLive))
+	}
+	if r.Class != RecordClass_UNKNOWN {
+		fields = append(fields, r.Class.String())
+	}
+	fields = append(fields, r.Type.String())
+
+	data := make([]string, len(r.Data))
+	for i, token := range r.Data {
+		data[i] = token
+		if needsQuoting(token) {
+			data[i] = `"` + stringEscaper.Replace(token) + `"`
+		}
+	}
+	fields = append(fields, strings.Join(data, " "))
+	if len(r.Comment) != 0 {
+		fields = append(fields, r.Comment)
+	}
+
+	_, err := zw.w.WriteString(strings.Join(fields, "\t") + "\n")
+	return err
+}
+
+// needsQuoting reports whether token would not be read back by the Scanner
+// as a single, identical token.
+func needsQuoting(token string) bool {
+	if token == "(" || token == ")" {
+		return false
+	}
+	if len(token) >= 2 && token[0] == '"' && token[len(token)-1] == '"' {
+		return false
+	}
+	return len(token) == 0 || strings.ContainsAny(token, " \t\r\n;()\"")
+}
+
+// WriteComment writes each line of text as a comment line.
+func (zw *Writer) WriteComment(text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		if _, err := zw.w.WriteString("; " + line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (zw *Writer) Flush() error {
+	return zw.w.Flush()
+}
@@ -0,0 +1,66 @@
+package zoneparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	const zone = `example. 3600 IN SOA ns1.example. hostmaster.example. ( 2024010101 7200 3600 1209600 3600 )
+example. 3600 IN NS ns1.example.
+www 300 IN A 192.0.2.1
+@ IN MX 10 mail
+txt.example. TXT "hello world" "a \"quoted\" ; not a comment"
+*.wild.example. 60 CH TXT x ; a comment
+`
+	records, errs := scanAll(t, strings.NewReader(zone))
+	if len(errs) != 0 || len(records) != 6 {
+		t.Fatalf("got %d records and errors %v", len(records), errs)
+	}
+
+	var out strings.Builder
+	w := NewWriter(&out)
+	for _, record := range records {
+		if err := w.WriteRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	again, errs := scanAll(t, strings.NewReader(out.String()))
+	if len(errs) != 0 || !reflect.DeepEqual(again, records) {
+		t.Errorf("read back\n%s\nas %v, %v; want %v", out.String(), again, errs, records)
+	}
+}
+
+func TestWriterQuoting(t *testing.T) {
+	for _, tc := range []struct {
+		data []string
+		want string
+	}{
+		{data: []string{"plain"}, want: "plain"},
+		{data: []string{`"already quoted"`}, want: `"already quoted"`},
+		{data: []string{"two words"}, want: `"two words"`},
+		{data: []string{`say "hi"; bye`}, want: `"say \"hi\"; bye"`},
+		{data: []string{""}, want: `""`},
+		{data: []string{"(", "x", ")"}, want: "( x )"},
+	} {
+		var out strings.Builder
+		w := NewWriter(&out)
+		if err := w.WriteRecord(Record{DomainName: "a.", TimeToLive: -1, Type: RecordType_TXT, Data: tc.data}); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if want := "a.\tTXT\t" + tc.want + "\n"; out.String() != want {
+			t.Errorf("%q written as %q, want %q", tc.data, out.String(), want)
+		}
+	}
+
+	w := NewWriter(&strings.Builder{})
+	if err := w.WriteRecord(Record{TimeToLive: -1, Type: RecordType_A, Data: []string{"192.0.2.1"}}); err == nil {
+		t.Error("record without owner name written")
+	}
+}
@@ -3,12 +3,18 @@ package zoneparse
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"unicode"
+
+	"zf-analysis/compression"
 )
 
 type RecordClass int
@@ -72,9 +78,37 @@ const (
 	RecordType_SPF
 	RecordType_SRV
 	RecordType_SSHFP
+	RecordType_URI
+	RecordType_CDS
+	RecordType_CDNSKEY
+	RecordType_OPENPGPKEY
+	RecordType_NSEC
+
+	recordType_end // keep last; bounds AllRecordTypes
 )
 
+// RecordType_Generic is the base of the RFC 3597 "TYPE<N>" range used for
+// types without a constant of their own: type N is RecordType_Generic + N.
+const RecordType_Generic = 1 << 16
+
+// AllRecordTypes lists every known record type, in declaration order.
+var AllRecordTypes []RecordType
+
+// RecordTypeNames maps the name of every type in AllRecordTypes to its type.
+var RecordTypeNames = make(map[string]RecordType)
+
+func init() {
+	for rt := RecordType(RecordType_A); rt < recordType_end; rt++ {
+		AllRecordTypes = append(AllRecordTypes, rt)
+		RecordTypeNames[rt.String()] = rt
+	}
+}
+
 func (rt RecordType) String() string {
+	if rt >= RecordType_Generic {
+		return fmt.Sprintf("TYPE%d", int(rt-RecordType_Generic))
+	}
+
 	switch rt {
 	case RecordType_A:
 		return "A"
@@ -134,11 +168,99 @@ func (rt RecordType) String() string {
 		return "SRV"
 	case RecordType_SSHFP:
 		return "SSHFP"
+	case RecordType_URI:
+		return "URI"
+	case RecordType_CDS:
+		return "CDS"
+	case RecordType_CDNSKEY:
+		return "CDNSKEY"
+	case RecordType_OPENPGPKEY:
+		return "OPENPGPKEY"
+	case RecordType_NSEC:
+		return "NSEC"
 	}
 
 	return "[UNKNOWN]"
 }
 
+// MarshalText encodes rt as its name, e.g. for use as a JSON map key.
+func (rt RecordType) MarshalText() ([]byte, error) {
+	return []byte(rt.String()), nil
+}
+
+// UnmarshalText decodes a record type name.
+func (rt *RecordType) UnmarshalText(text []byte) error {
+	parsed, err := parseType(string(text))
+	if err != nil {
+		return err
+	}
+	*rt = parsed
+	return nil
+}
+
+// IsDNSSEC reports whether rt is one of the DNSSEC record types, whose owner
+// names (hashed names in the case of NSEC3) say nothing about delegations.
+func (rt RecordType) IsDNSSEC() bool {
+	switch rt {
+	case RecordType_DNSKEY, RecordType_RRSIG, RecordType_NSEC, RecordType_NSEC3,
+		RecordType_NSEC3PARAM, RecordType_DS, RecordType_CDS, RecordType_CDNSKEY:
+		return true
+	}
+	return false
+}
+
+// IsMailRelated reports whether rt exists for mail delivery: MX and SPF.
+// TXT is not included, as only some TXT records (SPF, DMARC, DKIM) concern
+// mail.
+func (rt RecordType) IsMailRelated() bool {
+	return rt == RecordType_MX || rt == RecordType_SPF
+}
+
+// IsObsolete reports whether rt is one of the experimental or obsolete
+// RFC 1035 types that should no longer be used.
+func (rt RecordType) IsObsolete() bool {
+	switch rt {
+	case RecordType_MD, RecordType_MF, RecordType_MB, RecordType_MG,
+		RecordType_MR, RecordType_WKS, RecordType_NULL:
+		return true
+	}
+	return false
+}
+
+// RecordTypeSet is a set of record types for fast membership tests.
+type RecordTypeSet map[RecordType]struct{}
+
+func (set RecordTypeSet) Contains(rt RecordType) bool {
+	_, ok := set[rt]
+	return ok
+}
+
+// LookupTableFromTypes builds a RecordTypeSet from type names such as "A" or
+// "TYPE65534". Surrounding spaces and empty names are ignored; the error
+// lists every name that is not a known record type.
+func LookupTableFromTypes(types []string) (RecordTypeSet, error) {
+	set := make(RecordTypeSet)
+	var unknown []string
+	for _, name := range types {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		rt, err := parseType(name)
+		if err != nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		set[rt] = struct{}{}
+	}
+
+	if len(unknown) != 0 {
+		return nil, fmt.Errorf("Unknown Record Types: %s", strings.Join(unknown, ", "))
+	}
+	return set, nil
+}
+
 type Record struct {
 	DomainName string
 	TimeToLive int64 // uint32, expanded and signed to allow for "unset" indicator
@@ -149,13 +271,19 @@ type Record struct {
 }
 
 func (r Record) String() string {
+	return r.Compact(-1, RecordClass_UNKNOWN)
+}
+
+// Compact is like String but also omits the TTL when it equals defaultTTL
+// and the class when it equals defaultClass.
+func (r Record) Compact(defaultTTL int64, defaultClass RecordClass) string {
 	spec := []string{r.DomainName}
 
-	if r.TimeToLive != -1 {
+	if r.TimeToLive != -1 && r.TimeToLive != defaultTTL {
 		spec = append(spec, fmt.Sprintf("%d", r.TimeToLive))
 	}
 
-	if r.Class != RecordClass_UNKNOWN {
+	if r.Class != RecordClass_UNKNOWN && r.Class != defaultClass {
 		spec = append(spec, r.Class.String())
 	}
 
@@ -164,7 +292,11 @@ func (r Record) String() string {
 	}
 
 	if len(r.Data) != 0 {
-		spec = append(spec, strings.Join(r.Data, " "))
+		data := r.Data
+		if r.Type == RecordType_TXT || r.Type == RecordType_SPF {
+			data = quoteStrings(data)
+		}
+		spec = append(spec, strings.Join(data, " "))
 	}
 
 	if len(r.Comment) != 0 {
@@ -174,53 +306,527 @@ func (r Record) String() string {
 	return strings.Join(spec, " ")
 }
 
-type scannerState int
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteStrings returns TXT-style tokens as quoted strings. Tokens the
+// Scanner kept quoted and the parentheses of multi-line records are
+// returned unchanged.
+func quoteStrings(tokens []string) []string {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		if token == "(" || token == ")" || (len(token) >= 2 && token[0] == '"' && token[len(token)-1] == '"') {
+			quoted[i] = token
+			continue
+		}
+		quoted[i] = `"` + stringEscaper.Replace(token) + `"`
+	}
+	return quoted
+}
+
+// Clone returns a copy of r that shares no memory with it, so it can be kept
+// and modified independently.
+func (r Record) Clone() Record {
+	clone := r
+	if r.Data != nil {
+		clone.Data = make([]string, len(r.Data))
+		copy(clone.Data, r.Data)
+	}
+	return clone
+}
+
+// TXTValue returns the strings of the record's Data unquoted and joined
+// without separator.
+func (r Record) TXTValue() string {
+	var value strings.Builder
+	for _, token := range r.Data {
+		if token != "(" && token != ")" {
+			value.WriteString(unquote(token))
+		}
+	}
+	return value.String()
+}
+
+// canonicalName lower-cases name and strips its trailing dot.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Equal reports whether r and other are the same record: equal owner names,
+// compared case-insensitively, and equal TTL, class, type and Data.
+// Comments are ignored.
+func (r Record) Equal(other Record) bool {
+	return strings.EqualFold(r.DomainName, other.DomainName) &&
+		r.TimeToLive == other.TimeToLive &&
+		r.DataEqual(other)
+}
+
+// DataEqual reports whether r and other have the same class, type and Data,
+// regardless of owner name and TTL.
+func (r Record) DataEqual(other Record) bool {
+	if r.Class != other.Class || r.Type != other.Type || len(r.Data) != len(other.Data) {
+		return false
+	}
+	for i := range r.Data {
+		if r.Data[i] != other.Data[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsOwnedBy reports whether the record's owner name is apex or lies below it.
+// The comparison is case-insensitive and ignores trailing dots.
+func (r Record) IsOwnedBy(apex string) bool {
+	name, zone := canonicalName(r.DomainName), canonicalName(apex)
+	if len(zone) == 0 {
+		return true
+	}
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// IsApex reports whether the record's owner name is exactly apex, ignoring
+// case and trailing dots.
+func (r Record) IsApex(apex string) bool {
+	return canonicalName(r.DomainName) == canonicalName(apex)
+}
+
+// ScannerState is the state of the Scanner's tokenizer.
+type ScannerState int
 
 const (
-	scannerState_Default = iota
-	scannerState_String
-	scannerState_StringEscape
-	scannerState_Paren
-	scannerState_Comment
-	scannerState_Space
-	scannerState_ParenComment
-	scannerState_ParenString
-	scannerState_ParenStringEscape
+	ScannerState_Default ScannerState = iota
+	ScannerState_String
+	ScannerState_StringEscape
+	ScannerState_Paren
+	ScannerState_Comment
+	ScannerState_Space
+	ScannerState_ParenComment
+	ScannerState_ParenString
+	ScannerState_ParenStringEscape
 )
 
+func (ss ScannerState) String() string {
+	switch ss {
+	case ScannerState_Default:
+		return "Default"
+	case ScannerState_String:
+		return "String"
+	case ScannerState_StringEscape:
+		return "StringEscape"
+	case ScannerState_Paren:
+		return "Paren"
+	case ScannerState_Comment:
+		return "Comment"
+	case ScannerState_Space:
+		return "Space"
+	case ScannerState_ParenComment:
+		return "ParenComment"
+	case ScannerState_ParenString:
+		return "ParenString"
+	case ScannerState_ParenStringEscape:
+		return "ParenStringEscape"
+	}
+
+	return "[UNKNOWN]"
+}
+
+// countingReader tracks the number of bytes read from inner.
+type countingReader struct {
+	inner io.Reader
+	n     int64 // accessed atomically
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.inner.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// ScannerStats is a snapshot of a Scanner's counters.
+type ScannerStats struct {
+	LinesProcessed uint64
+	RecordsEmitted uint64
+	TokensScanned  uint64
+	BytesRead      uint64
+	ErrorCount     uint64
+	SkippedRecords uint64 // records of unknown type dropped by SkipUnknownTypes
+}
+
 type Scanner struct {
-	src      *bufio.Reader
-	state    scannerState
-	nextRune rune
-	nextSize int
+	// counters are first to keep them 64-bit aligned for sync/atomic
+	lines   uint64
+	records uint64
+	tokens  uint64
+	errors  uint64
+	skipped uint64
+
+	src        *bufio.Reader   // the tokenizer's reader: raw or dec
+	raw        *bufio.Reader   // reads the source and sniffs its compression
+	dec        *bufio.Reader   // reads the decompressed stream of compressed input
+	decoder    io.ReadCloser   // decompresses raw for dec
+	rawCount   countingReader  // counts the bytes read by raw
+	decCount   countingReader  // counts the bytes read by dec
+	counter    *countingReader // rawCount or decCount, whichever feeds src
+	state      ScannerState
+	initState  ScannerState // state Reset returns to, see WithInitialState
+	nextRune   rune
+	nextSize   int
+	lineEnding string
+	format     string
+	err        error // read or decompression error that ended the scan
+	done       bool  // Next returns io.EOF from now on
+
+	autoLineEnding bool
+
+	peeked  bool
+	peekRec Record
+	peekErr error
+
+	maxErrors int
+	errCount  int
+
+	readAheadBytes int
+	readAhead      *readAheadReader
+
+	onRecord func(Record)
+	onError  func(error)
+
+	concatTXT bool
+
+	bufSize          int
+	maxTokenSize     int
+	skipUnknownTypes bool
+	strict           bool
+}
+
+// errSkipped is returned by next for a record dropped by SkipUnknownTypes.
+var errSkipped = errors.New("record skipped")
+
+// ErrTooManyErrors is returned by Next once the limit set with WithMaxErrors
+// has been reached. Later calls return io.EOF.
+var ErrTooManyErrors = errors.New("too many consecutive parse errors")
+
+// ErrStop can be returned by the IterRecords callback to end iteration
+// early without an error.
+var ErrStop = errors.New("stop iteration")
+
+// ScannerOption configures optional Scanner behaviour in NewScanner.
+type ScannerOption func(*Scanner)
+
+// WithLineEnding sets the line-ending sequence of the input: "\n" (the
+// default), "\r\n", "\r" or "auto". In "auto" mode the first 4096 bytes are
+// inspected and the most frequent ending is used. Other values are ignored.
+func WithLineEnding(le string) ScannerOption {
+	return func(s *Scanner) {
+		switch le {
+		case "\n", "\r\n", "\r", "auto":
+			s.lineEnding = le
+		}
+	}
+}
+
+// WithMaxErrors makes Next return ErrTooManyErrors after n consecutive parse
+// errors. The count is reset by every successfully parsed record.
+func WithMaxErrors(n int) ScannerOption {
+	return func(s *Scanner) {
+		s.maxErrors = n
+	}
+}
+
+// WithReadAhead reads the source in a background goroutine, buffering up to
+// about bufferBytes ahead of the tokenizer. This helps on slow storage where
+// the scanner would otherwise wait on every read. Call Close when done with
+// the scanner to stop the goroutine.
+func WithReadAhead(bufferBytes int) ScannerOption {
+	return func(s *Scanner) {
+		s.readAheadBytes = bufferBytes
+	}
+}
+
+// WithRecordCallback sets the function Run calls for each parsed record.
+func WithRecordCallback(fn func(Record)) ScannerOption {
+	return func(s *Scanner) {
+		s.onRecord = fn
+	}
+}
+
+// WithErrorHandler sets the function IterRecords calls for each record that
+// fails to parse. Without it such records are skipped silently.
+func WithErrorHandler(fn func(error)) ScannerOption {
+	return func(s *Scanner) {
+		s.onError = fn
+	}
+}
+
+// WithTXTConcatenation makes Next store the strings of each TXT record as
+// a single Data element, unquoted and joined without separator, as SPF and
+// DMARC evaluation requires.
+func WithTXTConcatenation(concat bool) ScannerOption {
+	return func(s *Scanner) {
+		s.concatTXT = concat
+	}
+}
+
+// WithInitialState starts the scanner in state instead of
+// ScannerState_Default, e.g. to scan a fragment that begins inside a
+// parenthesized record or a quoted string.
+func WithInitialState(state ScannerState) ScannerOption {
+	return func(s *Scanner) {
+		s.state = state
+		s.initState = state
+	}
+}
+
+// ScannerOptions groups the settings of NewScannerWithOptions. The zero
+// value gives the same scanner as NewScanner without options.
+type ScannerOptions struct {
+	// BufSize is the size of the read buffer; 4096 when zero.
+	BufSize int
+
+	// MaxTokenSize, when positive, makes tokens longer than this many bytes
+	// a parse error.
+	MaxTokenSize int
+
+	// SkipUnknownTypes drops records of unknown type instead of returning
+	// an error for them.
+	SkipUnknownTypes bool
+
+	// StrictMode turns conditions the scanner otherwise tolerates into
+	// errors: TTLs above 2^31-1 (RFC 2181 section 8) and unknown types
+	// skipped by SkipUnknownTypes.
+	StrictMode bool
+}
+
+// NewScannerWithOptions is NewScanner configured by a ScannerOptions value.
+// Further functional options are applied after it.
+func NewScannerWithOptions(src io.Reader, so ScannerOptions, opts ...ScannerOption) *Scanner {
+	withOptions := func(s *Scanner) {
+		s.bufSize = so.BufSize
+		s.maxTokenSize = so.MaxTokenSize
+		s.skipUnknownTypes = so.SkipUnknownTypes
+		s.strict = so.StrictMode
+	}
+	return NewScanner(src, append([]ScannerOption{withOptions}, opts...)...)
 }
 
-func NewScanner(src io.Reader) *Scanner {
-	return &Scanner{
-		src:      bufio.NewReader(src),
-		nextRune: 0,
-		nextSize: 0,
+func NewScanner(src io.Reader, opts ...ScannerOption) *Scanner {
+	s := &Scanner{
+		nextRune:   0,
+		nextSize:   0,
+		lineEnding: "\n",
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.autoLineEnding = s.lineEnding == "auto"
+
+	s.init(src)
+	return s
+}
+
+// init sets up the reader chain for src, reusing the readers of an earlier
+// source. Compressed input, detected by its magic bytes, is decompressed.
+func (s *Scanner) init(src io.Reader) {
+	if s.readAheadBytes > 0 {
+		s.readAhead = newReadAheadReader(src, s.readAheadBytes)
+		src = s.readAhead
+	}
+	s.rawCount = countingReader{inner: src}
+	s.raw = s.resetReader(s.raw, &s.rawCount)
+	s.src, s.counter = s.raw, &s.rawCount
+	s.format, s.err = "", nil
+
+	if format, err := compression.Peek(s.raw); err == nil && format != compression.None {
+		s.format = format
+		if s.decoder, s.err = compression.Open(s.raw); s.err != nil {
+			s.decoder = nil
+		}
 	}
+	if s.decoder != nil {
+		s.decCount = countingReader{inner: s.decoder}
+		s.dec = s.resetReader(s.dec, &s.decCount)
+		s.src, s.counter = s.dec, &s.decCount
+	}
+
+	if s.autoLineEnding {
+		s.lineEnding = s.detectLineEnding()
+	}
+}
+
+// resetReader returns br reset to read from r, or a new reader of the
+// configured buffer size when br is nil.
+func (s *Scanner) resetReader(br *bufio.Reader, r io.Reader) *bufio.Reader {
+	if br != nil {
+		br.Reset(r)
+		return br
+	}
+	if s.bufSize > 0 {
+		return bufio.NewReaderSize(r, s.bufSize)
+	}
+	return bufio.NewReader(r)
+}
+
+// Reset makes the scanner read from src as if newly created with the same
+// options, reusing its buffers. Counters and error state start over.
+func (s *Scanner) Reset(src io.Reader) {
+	s.Close()
+	s.readAhead = nil
+
+	atomic.StoreUint64(&s.lines, 0)
+	atomic.StoreUint64(&s.records, 0)
+	atomic.StoreUint64(&s.tokens, 0)
+	atomic.StoreUint64(&s.errors, 0)
+	atomic.StoreUint64(&s.skipped, 0)
+	s.state = s.initState
+	s.nextRune = 0
+	s.nextSize = 0
+	s.errCount = 0
+	s.done = false
+	s.peeked = false
+
+	s.init(src)
+}
+
+// Close releases resources held by the scanner, such as the WithReadAhead
+// goroutine. It does not close the source reader.
+func (s *Scanner) Close() error {
+	if s.readAhead != nil {
+		s.readAhead.stop()
+	}
+	if s.decoder != nil {
+		s.decoder.Close()
+		s.decoder = nil
+	}
+	return nil
+}
+
+// IsCompressed reports whether NewScanner detected compressed input.
+func (s *Scanner) IsCompressed() bool {
+	return len(s.format) != 0
+}
+
+// CompressionFormat returns the detected compression ("gzip", "zstd",
+// "bzip2"), or an empty string for plain input.
+func (s *Scanner) CompressionFormat() string {
+	return s.format
+}
+
+// Offset returns the byte offset in the source of the next unconsumed byte.
+func (s *Scanner) Offset() int64 {
+	return atomic.LoadInt64(&s.counter.n) - int64(s.src.Buffered()) - int64(s.nextSize)
+}
+
+// Stats returns a snapshot of the scanner's counters. It is safe to call
+// from another goroutine while scanning.
+func (s *Scanner) Stats() ScannerStats {
+	return ScannerStats{
+		LinesProcessed: atomic.LoadUint64(&s.lines),
+		RecordsEmitted: atomic.LoadUint64(&s.records),
+		TokensScanned:  atomic.LoadUint64(&s.tokens),
+		BytesRead:      uint64(atomic.LoadInt64(&s.counter.n)),
+		ErrorCount:     atomic.LoadUint64(&s.errors),
+		SkippedRecords: atomic.LoadUint64(&s.skipped),
+	}
+}
+
+// detectLineEnding peeks at the start of the input and returns the most
+// frequent line ending found there, defaulting to "\n".
+func (s *Scanner) detectLineEnding() string {
+	buf, _ := s.src.Peek(4096)
+
+	var lf, cr, crlf int
+	for i := 0; i < len(buf); i++ {
+		switch buf[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(buf) && buf[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		}
+	}
+
+	if crlf > lf && crlf >= cr {
+		return "\r\n"
+	}
+	if cr > lf && cr > crlf {
+		return "\r"
+	}
+	return "\n"
+}
+
+// readRune reads the next rune from the source, translating the configured
+// line ending into a single '\n'.
+func (s *Scanner) readRune() (rune, int, error) {
+	r, size, err := s.src.ReadRune()
+	if err != nil && err != io.EOF {
+		// read errors are not recoverable; Next returns this one and then
+		// io.EOF
+		s.err = err
+	}
+	if err == nil && r == '\n' {
+		atomic.AddUint64(&s.lines, 1)
+	}
+	if err != nil || r != '\r' {
+		return r, size, err
+	}
+
+	switch s.lineEnding {
+	case "\r":
+		atomic.AddUint64(&s.lines, 1)
+		return '\n', size, nil
+	case "\r\n":
+		next, nextSize, err := s.src.ReadRune()
+		if err == nil {
+			if next == '\n' {
+				atomic.AddUint64(&s.lines, 1)
+				return '\n', size + nextSize, nil
+			}
+			_ = s.src.UnreadRune()
+		}
+	}
+
+	return r, size, nil
 }
 
 func (s *Scanner) nextToken() (string, error) {
+	token, err := s.readToken()
+	if err == nil {
+		atomic.AddUint64(&s.tokens, 1)
+	}
+	return token, err
+}
+
+func (s *Scanner) readToken() (string, error) {
 	var token bytes.Buffer
 
 	var r rune
 	var size int
 	var err error
 	for {
+		if s.maxTokenSize > 0 && token.Len() > s.maxTokenSize {
+			s.skipToRecordEnd()
+			return "", fmt.Errorf("token longer than %d bytes", s.maxTokenSize)
+		}
+
 		if s.nextSize != 0 {
 			r = s.nextRune
 			size = s.nextSize
 			s.nextSize = 0
 		} else {
-			r, size, err = s.src.ReadRune()
+			r, size, err = s.readRune()
 			if err != nil {
 				if err == io.EOF {
-					if s.state != scannerState_Default &&
-						s.state != scannerState_Space &&
-						s.state != scannerState_Comment {
+					if s.state != ScannerState_Default &&
+						s.state != ScannerState_Space &&
+						s.state != ScannerState_Comment {
+						// the state cannot recover without more input; end
+						// the scan here instead of repeating this error
+						s.done = true
 						return "", errors.New("Unexpected end of input")
 					}
 
@@ -237,16 +843,16 @@ func (s *Scanner) nextToken() (string, error) {
 		s.nextSize = size
 
 		switch s.state {
-		case scannerState_Default, scannerState_Paren:
+		case ScannerState_Default, ScannerState_Paren:
 			if unicode.IsSpace(r) {
 				if token.Len() > 0 {
 					return token.String(), nil
 				}
 
-				if s.state == scannerState_Default {
+				if s.state == ScannerState_Default {
 					if r == '\n' {
 						s.nextSize = 0
-						s.state = scannerState_Space
+						s.state = ScannerState_Space
 						return "\n", nil
 					}
 				}
@@ -256,24 +862,24 @@ func (s *Scanner) nextToken() (string, error) {
 				continue
 			}
 
-			if s.state == scannerState_Default {
+			if s.state == ScannerState_Default {
 				if r == '(' {
 					if token.Len() > 0 {
 						return token.String(), nil
 					}
 
 					s.nextSize = 0
-					s.state = scannerState_Paren
+					s.state = ScannerState_Paren
 					return "(", nil
 				}
-			} else if s.state == scannerState_Paren {
+			} else if s.state == ScannerState_Paren {
 				if r == ')' {
 					if token.Len() > 0 {
 						return token.String(), nil
 					}
 
 					s.nextSize = 0
-					s.state = scannerState_Default
+					s.state = ScannerState_Default
 					return ")", nil
 				}
 			}
@@ -284,10 +890,10 @@ func (s *Scanner) nextToken() (string, error) {
 				}
 
 				s.nextSize = 0
-				if s.state == scannerState_Default {
-					s.state = scannerState_String
+				if s.state == ScannerState_Default {
+					s.state = ScannerState_String
 				} else {
-					s.state = scannerState_ParenString
+					s.state = ScannerState_ParenString
 				}
 				_, _ = token.WriteRune(r)
 				continue
@@ -299,10 +905,10 @@ func (s *Scanner) nextToken() (string, error) {
 				}
 
 				s.nextSize = 0
-				if s.state == scannerState_Default {
-					s.state = scannerState_Comment
+				if s.state == ScannerState_Default {
+					s.state = ScannerState_Comment
 				} else {
-					s.state = scannerState_ParenComment
+					s.state = ScannerState_ParenComment
 				}
 				_, _ = token.WriteRune(r)
 				continue
@@ -311,13 +917,13 @@ func (s *Scanner) nextToken() (string, error) {
 			s.nextSize = 0
 			_, _ = token.WriteRune(r)
 
-		case scannerState_String, scannerState_ParenString:
+		case ScannerState_String, ScannerState_ParenString:
 			if r == '"' {
 				s.nextSize = 0
-				if s.state == scannerState_String {
-					s.state = scannerState_Default
+				if s.state == ScannerState_String {
+					s.state = ScannerState_Default
 				} else {
-					s.state = scannerState_Paren
+					s.state = ScannerState_Paren
 				}
 				_, _ = token.WriteRune(r)
 				return token.String(), nil
@@ -325,10 +931,10 @@ func (s *Scanner) nextToken() (string, error) {
 
 			if r == '\\' {
 				s.nextSize = 0
-				if s.state == scannerState_String {
-					s.state = scannerState_StringEscape
+				if s.state == ScannerState_String {
+					s.state = ScannerState_StringEscape
 				} else {
-					s.state = scannerState_ParenStringEscape
+					s.state = ScannerState_ParenStringEscape
 				}
 				_, _ = token.WriteRune(r)
 				continue
@@ -337,21 +943,21 @@ func (s *Scanner) nextToken() (string, error) {
 			s.nextSize = 0
 			_, _ = token.WriteRune(r)
 
-		case scannerState_StringEscape, scannerState_ParenStringEscape:
+		case ScannerState_StringEscape, ScannerState_ParenStringEscape:
 			s.nextSize = 0
-			if s.state == scannerState_StringEscape {
-				s.state = scannerState_String
+			if s.state == ScannerState_StringEscape {
+				s.state = ScannerState_String
 			} else {
-				s.state = scannerState_ParenString
+				s.state = ScannerState_ParenString
 			}
 			_, _ = token.WriteRune(r)
 
-		case scannerState_Comment, scannerState_ParenComment:
+		case ScannerState_Comment, ScannerState_ParenComment:
 			if r == '\n' {
-				if s.state == scannerState_Comment {
-					s.state = scannerState_Default
+				if s.state == ScannerState_Comment {
+					s.state = ScannerState_Default
 				} else {
-					s.state = scannerState_Paren
+					s.state = ScannerState_Paren
 				}
 				continue
 			}
@@ -359,18 +965,86 @@ func (s *Scanner) nextToken() (string, error) {
 			s.nextSize = 0
 			_, _ = token.WriteRune(r)
 
-		case scannerState_Space:
+		case ScannerState_Space:
 			if unicode.IsSpace(r) {
 				s.nextSize = 0
 				continue
 			}
 
-			s.state = scannerState_Default
+			s.state = ScannerState_Default
 			continue
 		}
 	}
 }
 
+// skipToRecordEnd discards input up to the newline that ends the current
+// record, following quotes and parentheses like readToken, so that the rest
+// of a rejected record is not read as further records.
+func (s *Scanner) skipToRecordEnd() {
+	for {
+		r := s.nextRune
+		if s.nextSize != 0 {
+			s.nextSize = 0
+		} else {
+			var err error
+			if r, _, err = s.readRune(); err != nil {
+				return
+			}
+		}
+
+		switch s.state {
+		case ScannerState_Default, ScannerState_Space:
+			switch r {
+			case '\n':
+				s.state = ScannerState_Space
+				return
+			case '(':
+				s.state = ScannerState_Paren
+			case '"':
+				s.state = ScannerState_String
+			case ';':
+				s.state = ScannerState_Comment
+			}
+		case ScannerState_Paren:
+			switch r {
+			case ')':
+				s.state = ScannerState_Default
+			case '"':
+				s.state = ScannerState_ParenString
+			case ';':
+				s.state = ScannerState_ParenComment
+			}
+		case ScannerState_String, ScannerState_ParenString:
+			if r == '"' {
+				if s.state == ScannerState_String {
+					s.state = ScannerState_Default
+				} else {
+					s.state = ScannerState_Paren
+				}
+			} else if r == '\\' {
+				if s.state == ScannerState_String {
+					s.state = ScannerState_StringEscape
+				} else {
+					s.state = ScannerState_ParenStringEscape
+				}
+			}
+		case ScannerState_StringEscape:
+			s.state = ScannerState_String
+		case ScannerState_ParenStringEscape:
+			s.state = ScannerState_ParenString
+		case ScannerState_Comment:
+			if r == '\n' {
+				s.state = ScannerState_Space
+				return
+			}
+		case ScannerState_ParenComment:
+			if r == '\n' {
+				s.state = ScannerState_Paren
+			}
+		}
+	}
+}
+
 func parseClass(token string) (RecordClass, error) {
 	switch strings.ToUpper(token) {
 	case "IN":
@@ -388,72 +1062,167 @@ func parseClass(token string) (RecordClass, error) {
 	}
 }
 
+// LookupType returns the record type named name (case-insensitive),
+// including RFC 3597 "TYPE<N>" names.
+func LookupType(name string) (RecordType, bool) {
+	upper := strings.ToUpper(name)
+	if rt, ok := RecordTypeNames[upper]; ok {
+		return rt, true
+	}
+
+	if strings.HasPrefix(upper, "TYPE") {
+		if n, err := strconv.ParseUint(upper[4:], 10, 16); err == nil {
+			return RecordTypeFromInt(int(n)), true
+		}
+	}
+
+	return RecordType_UNKNOWN, false
+}
+
 func parseType(token string) (RecordType, error) {
-	switch strings.ToUpper(token) {
-	case "A":
-		return RecordType_A, nil
-	case "NS":
-		return RecordType_NS, nil
-	case "MD":
-		return RecordType_MD, nil
-	case "MF":
-		return RecordType_MF, nil
-	case "CNAME":
-		return RecordType_CNAME, nil
-	case "SOA":
-		return RecordType_SOA, nil
-	case "MB":
-		return RecordType_MB, nil
-	case "MG":
-		return RecordType_MG, nil
-	case "MR":
-		return RecordType_MR, nil
-	case "NULL":
-		return RecordType_NULL, nil
-	case "WKS":
-		return RecordType_WKS, nil
-	case "PTR":
-		return RecordType_PTR, nil
-	case "HINFO":
-		return RecordType_HINFO, nil
-	case "MINFO":
-		return RecordType_MINFO, nil
-	case "MX":
-		return RecordType_MX, nil
-	case "TXT":
-		return RecordType_TXT, nil
-	case "AAAA":
-		return RecordType_AAAA, nil
-	case "AFSDB":
-		return RecordType_AFSDB, nil
-	case "DNSKEY":
-		return RecordType_DNSKEY, nil
-	case "DS":
-		return RecordType_DS, nil
-	case "LOC":
-		return RecordType_LOC, nil
-	case "NAPTR":
-		return RecordType_NAPTR, nil
-	case "NSEC3":
-		return RecordType_NSEC3, nil
-	case "NSEC3PARAM":
-		return RecordType_NSEC3PARAM, nil
-	case "RP":
-		return RecordType_RP, nil
-	case "RRSIG":
-		return RecordType_RRSIG, nil
-	case "SPF":
-		return RecordType_SPF, nil
-	case "SRV":
-		return RecordType_SRV, nil
-	case "SSHFP":
-		return RecordType_SSHFP, nil
-	default:
+	rt, ok := LookupType(token)
+	if !ok {
 		return 0, fmt.Errorf("Unknown Record Type '%s'", token)
 	}
+	return rt, nil
 }
 
 func (s *Scanner) Next(outrecord *Record) error {
+	if s.peeked {
+		s.peeked = false
+		*outrecord = s.peekRec
+		return s.peekErr
+	}
+	if s.done {
+		return io.EOF
+	}
+	if s.err != nil {
+		// the source could not be decompressed
+		s.done = true
+		return s.err
+	}
+	if s.maxErrors > 0 && s.errCount >= s.maxErrors {
+		s.done = true
+		return ErrTooManyErrors
+	}
+
+	err := s.next(outrecord)
+	for err == errSkipped {
+		err = s.next(outrecord)
+	}
+	if s.err != nil {
+		s.done = true
+	}
+	if err != nil && err != io.EOF {
+		s.errCount++
+		atomic.AddUint64(&s.errors, 1)
+	} else if err == nil {
+		s.errCount = 0
+		atomic.AddUint64(&s.records, 1)
+		if s.concatTXT && outrecord.Type == RecordType_TXT {
+			outrecord.Data = []string{outrecord.TXTValue()}
+		}
+	}
+
+	return err
+}
+
+// Err returns the read or decompression error that ended the scan, or nil.
+// Next returns such an error once, like a parse error, and io.EOF after it;
+// callers that skip parse errors tell the two apart with Err.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Peek returns the record the next call to Next will return, without
+// consuming it. The record is owned by the scanner and only valid until the
+// next call to Next.
+func (s *Scanner) Peek() (*Record, error) {
+	if !s.peeked {
+		s.peekRec = Record{}
+		s.peekErr = s.Next(&s.peekRec)
+		s.peeked = true
+	}
+	if s.peekErr != nil {
+		return nil, s.peekErr
+	}
+	return &s.peekRec, nil
+}
+
+// SeekToSOA discards records up to the next SOA record and returns it. It
+// returns io.EOF when the input ends first, and stops at the first parse
+// error; calling it again resumes the search.
+func (s *Scanner) SeekToSOA() (*Record, error) {
+	var record Record
+	for {
+		if err := s.Next(&record); err != nil {
+			return nil, err
+		}
+		if record.Type == RecordType_SOA {
+			return &record, nil
+		}
+	}
+}
+
+// IterRecords scans src and calls fn for each record. It returns nil at the
+// end of input or when fn returns ErrStop, and otherwise the first error
+// returned by fn or by reading src. Records that fail to parse are passed to
+// the WithErrorHandler function, if any, and skipped.
+func IterRecords(src io.Reader, fn func(Record) error, opts ...ScannerOption) error {
+	s := NewScanner(src, opts...)
+	defer s.Close()
+
+	var record Record
+	for {
+		err := s.Next(&record)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == ErrTooManyErrors || (err != nil && s.err != nil):
+			return err
+		case err != nil:
+			if s.onError != nil {
+				s.onError(err)
+			}
+			continue
+		}
+
+		if err := fn(record); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Run scans the whole input, passing each record to the WithRecordCallback
+// function. It returns nil at end of input, or the first other error,
+// including ctx's error when it is cancelled.
+func (s *Scanner) Run(ctx context.Context) error {
+	if s.onRecord == nil {
+		return errors.New("Run requires WithRecordCallback")
+	}
+
+	var record Record
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := s.Next(&record); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		s.onRecord(record)
+	}
+}
+
+func (s *Scanner) next(outrecord *Record) error {
 	var record Record
 	var token string
 	var err error
@@ -499,6 +1268,9 @@ func (s *Scanner) Next(outrecord *Record) error {
 				if err != nil {
 					record.TimeToLive = -1
 				} else {
+					if s.strict && i64 > math.MaxInt32 {
+						return fmt.Errorf("TTL %d of %s exceeds 2^31-1", i64, record.DomainName)
+					}
 					record.TimeToLive = int64(i64)
 					hasTTL = true
 					continue
@@ -517,6 +1289,9 @@ func (s *Scanner) Next(outrecord *Record) error {
 
 			record.Type, err = parseType(token)
 			if err != nil {
+				if s.skipUnknownTypes && !s.strict {
+					return s.skipRecord()
+				}
 				return err
 			} else {
 				hasType = true
@@ -551,3 +1326,73 @@ func (s *Scanner) Next(outrecord *Record) error {
 	*outrecord = record
 	return nil
 }
+
+// skipRecord consumes the rest of the current record and returns errSkipped,
+// or the error that ended the input.
+func (s *Scanner) skipRecord() error {
+	for {
+		token, err := s.nextToken()
+		if err == io.EOF || token == "\n" {
+			atomic.AddUint64(&s.skipped, 1)
+		}
+		if err != nil {
+			return err
+		}
+		if token == "\n" {
+			return errSkipped
+		}
+	}
+}
+
+// ParsePartialLine parses one record from line. complete is false when line
+// ends inside a parenthesized group or a quoted string; callers then append
+// the next line and call again with the accumulated text.
+func ParsePartialLine(line string) (r Record, complete bool, err error) {
+	s := NewScanner(strings.NewReader(line + "\n"))
+	err = s.Next(&r)
+
+	switch s.state {
+	case ScannerState_Paren, ScannerState_ParenComment,
+		ScannerState_String, ScannerState_StringEscape,
+		ScannerState_ParenString, ScannerState_ParenStringEscape:
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, true, err
+	}
+	return r, true, nil
+}
+
+// ParseFile reads all records of the zone file at path, which may be gzip,
+// zstd or bzip2 compressed. It stops at the first parse error.
+func ParseFile(path string, opts ...ScannerOption) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseAll(f, opts)
+}
+
+// ParseBytes is like ParseFile for zone data held in memory.
+func ParseBytes(data []byte, opts ...ScannerOption) ([]Record, error) {
+	return parseAll(bytes.NewReader(data), opts)
+}
+
+func parseAll(src io.Reader, opts []ScannerOption) ([]Record, error) {
+	s := NewScanner(src, opts...)
+	defer s.Close()
+
+	var records []Record
+	var record Record
+	for {
+		if err := s.Next(&record); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, record.Clone())
+	}
+}
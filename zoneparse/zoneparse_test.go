@@ -0,0 +1,594 @@
+package zoneparse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"zf-analysis/compression"
+)
+
+// failReader returns data and then err.
+type failReader struct {
+	data string
+	err  error
+}
+
+func (f *failReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, f.err
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+// scanAll returns the records of in and the errors Next returned for it,
+// failing the test if Next does not reach io.EOF.
+func scanAll(t *testing.T, in io.Reader, opts ...ScannerOption) ([]Record, []error) {
+	t.Helper()
+	s := NewScanner(in, opts...)
+	defer s.Close()
+
+	var records []Record
+	var errs []error
+	for i := 0; i < 1000; i++ {
+		var record Record
+		err := s.Next(&record)
+		switch {
+		case err == io.EOF:
+			return records, errs
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			records = append(records, record)
+		}
+	}
+	t.Fatalf("no io.EOF after 1000 calls to Next; errors: %v", errs)
+	return nil, nil
+}
+
+func TestScannerReadError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	s := NewScanner(&failReader{data: "a. 60 IN A 192.0.2.1\nb. 60 IN A 192", err: readErr})
+
+	var record Record
+	for i, want := range []error{nil, readErr, io.EOF, io.EOF} {
+		if err := s.Next(&record); err != want {
+			t.Fatalf("call %d: got %v, want %v", i, err, want)
+		}
+	}
+	if s.Err() != readErr {
+		t.Errorf("Err() = %v, want %v", s.Err(), readErr)
+	}
+}
+
+func TestIterRecordsReadError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	var n int
+	err := IterRecords(&failReader{data: "a. 60 IN A 192.0.2.1\n", err: readErr}, func(Record) error {
+		n++
+		return nil
+	})
+	if err != readErr || n != 1 {
+		t.Errorf("got %d records and %v, want 1 record and %v", n, err, readErr)
+	}
+
+	if err := IterRecords(strings.NewReader("a. 60 IN A 192.0.2.1\n"), func(Record) error { return nil }); err != nil {
+		t.Errorf("clean input: %v", err)
+	}
+}
+
+func TestScannerMaxTokenSize(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{name: "plain", in: "a. IN TXT " + long + " more tokens\nb. IN A 192.0.2.1\n"},
+		{name: "quoted", in: "a. IN TXT \"" + long + " \\\" (\n;\" rest\nb. IN A 192.0.2.1\n"},
+		{name: "parenthesized", in: "a. IN TXT ( " + long + "\n more\n ) ; done\nb. IN A 192.0.2.1\n"},
+		{name: "owner", in: long + " IN TXT x\nb. IN A 192.0.2.1\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records, errs := scanAll(t, strings.NewReader(tc.in), func(s *Scanner) {
+				s.maxTokenSize = 50 // as set by ScannerOptions.MaxTokenSize
+			})
+			if len(errs) != 1 || len(records) != 1 || records[0].DomainName != "b." {
+				t.Errorf("got records %v and errors %v, want only b. and one error", records, errs)
+			}
+		})
+	}
+}
+
+func TestScannerStateString(t *testing.T) {
+	for state, want := range map[ScannerState]string{
+		ScannerState_Default:           "Default",
+		ScannerState_Paren:             "Paren",
+		ScannerState_ParenStringEscape: "ParenStringEscape",
+		ScannerState(99):               "[UNKNOWN]",
+	} {
+		if got := fmt.Sprint(state); got != want {
+			t.Errorf("fmt.Sprint(%d) = %q, want %q", int(state), got, want)
+		}
+	}
+	if got := fmt.Sprint(ScannerState_Paren); got != "Paren" {
+		t.Errorf("constant prints as %q, want Paren", got)
+	}
+}
+
+// compressed returns data compressed in format.
+func compressed(t *testing.T, format, data string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := compression.NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestScannerReset(t *testing.T) {
+	const zone = "a. IN A 192.0.2.1\nb. IN A 192.0.2.2\n"
+	s := NewScanner(strings.NewReader(zone))
+	raw := s.raw
+	if s.src != s.raw {
+		t.Error("plain input is buffered twice")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		in     string
+		format string
+	}{
+		{name: "plain", in: zone},
+		{name: "gzip", in: compressed(t, compression.Gzip, zone), format: "gzip"},
+		{name: "gzip again", in: compressed(t, compression.Gzip, zone), format: "gzip"},
+		{name: "zstd", in: compressed(t, compression.Zstd, zone), format: "zstd"},
+		{name: "plain after zstd", in: zone},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s.Reset(strings.NewReader(tc.in))
+			if s.raw != raw {
+				t.Error("Reset allocated a new reader")
+			}
+			var record Record
+			var n int
+			for s.Next(&record) == nil {
+				n++
+			}
+			if n != 2 || s.CompressionFormat() != tc.format || s.Stats().BytesRead != uint64(len(zone)) {
+				t.Errorf("got %d records, format %q, %d bytes read", n, s.CompressionFormat(), s.Stats().BytesRead)
+			}
+		})
+	}
+}
+
+func TestScannerResetInitialState(t *testing.T) {
+	// a fragment that begins inside a parenthesized record
+	const fragment = "a. IN TXT x\n more ) \nb. IN A 192.0.2.2\n"
+	s := NewScanner(strings.NewReader(fragment), WithInitialState(ScannerState_Paren))
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			s.Reset(strings.NewReader(fragment))
+		}
+		var record Record
+		if err := s.Next(&record); err != nil || strings.Join(record.Data, " ") != "x more )" {
+			t.Errorf("pass %d: got %v, %v; want data \"x more )\"", i, record.Data, err)
+		}
+	}
+}
+
+func TestParsePartialLine(t *testing.T) {
+	for _, tc := range []struct {
+		lines []string // fed one by one until complete
+		data  string
+	}{
+		{lines: []string{"a. IN A 192.0.2.1"}, data: "192.0.2.1"},
+		{lines: []string{"a. IN NS ( ns1.example.", "  )"}, data: "( ns1.example. )"},
+		{lines: []string{"a. IN TXT ( ; comment", "  \"x\" )"}, data: "( \"x\" )"},
+		{lines: []string{"a. IN TXT \"one", "two\""}, data: "\"one\ntwo\""},
+		{lines: []string{"a. IN TXT ( \"one", "two\" )"}, data: "( \"one\ntwo\" )"},
+		{lines: []string{"a. IN TXT ( \"one\\", "two\" )"}, data: "( \"one\\\ntwo\" )"},
+	} {
+		var acc string
+		for i, line := range tc.lines {
+			if i > 0 {
+				acc += "\n"
+			}
+			acc += line
+
+			record, complete, err := ParsePartialLine(acc)
+			if last := i == len(tc.lines)-1; complete != last {
+				t.Errorf("%q: complete = %t after line %d", acc, complete, i+1)
+				break
+			}
+			if complete && (err != nil || strings.Join(record.Data, " ") != tc.data) {
+				t.Errorf("%q: got %q, %v; want %q", acc, record.Data, err, tc.data)
+			}
+		}
+	}
+}
+
+func TestScannerUnterminated(t *testing.T) {
+	for _, in := range []string{
+		"a. IN TXT \"unclosed\n",
+		"a. IN TXT \"unclosed\\",
+		"a. IN NS ( ns1.example.\n",
+		"a. IN TXT ( \"unclosed ) \n",
+	} {
+		s := NewScanner(strings.NewReader(in))
+		var record Record
+		if err := s.Next(&record); err == nil || err == io.EOF {
+			t.Errorf("%q: got %v, want a parse error", in, err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := s.Next(&record); err != io.EOF {
+				t.Errorf("%q: call %d after the error returned %v, want io.EOF", in, i+2, err)
+			}
+		}
+	}
+}
+
+// FuzzScanner checks that the Scanner reaches io.EOF on any input without
+// hanging or panicking. Run it with
+//
+//	go test ./zoneparse -run '^$' -fuzz=FuzzScanner -fuzztime=1m
+//
+// Inputs that fail are saved under testdata/fuzz/FuzzScanner and replayed by
+// plain go test runs.
+func FuzzScanner(f *testing.F) {
+	for _, seed := range []string{
+		"example. 3600 IN SOA ns1.example. hostmaster.example. ( 1 7200 3600 1209600 3600 )\nwww 300 IN A 192.0.2.1\n",
+		"a. IN TXT \"unclosed\n",
+		"a. IN NS ( ns1.example.\n",
+		"a. IN TXT \"esc\\",
+		"\x00\xff\x01(\"",
+		"\x1f\x8b\x08 not gzip",
+		"a. IN TXT " + strings.Repeat("x", 1<<16) + "\n",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range [][]ScannerOption{
+			nil,
+			{func(s *Scanner) { s.maxTokenSize = 64 }},
+		} {
+			s := NewScanner(bytes.NewReader(data), opts...)
+			var record Record
+			// every call either consumes input or ends the scan
+			for i := 0; ; i++ {
+				if i > len(data)+2 {
+					t.Fatalf("no io.EOF after %d calls to Next", i)
+				}
+				if s.Next(&record) == io.EOF {
+					break
+				}
+			}
+			s.Close()
+		}
+	})
+}
+
+func TestScannerOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		in      string
+		so      ScannerOptions
+		opts    []ScannerOption
+		names   string // owner names of the records read
+		data    string // Data of the first record, joined by "|"
+		errs    int
+		skipped uint64
+	}{
+		{
+			name:  "crlf",
+			in:    "a. IN A 192.0.2.1\r\nb. IN NS x. ; c\r\n",
+			opts:  []ScannerOption{WithLineEnding("\r\n")},
+			names: "a.,b.",
+			data:  "192.0.2.1",
+		},
+		{
+			name:  "auto cr",
+			in:    "a. IN A 192.0.2.1\rb. IN NS x.\r",
+			opts:  []ScannerOption{WithLineEnding("auto")},
+			names: "a.,b.",
+			data:  "192.0.2.1",
+		},
+		{
+			name:  "read ahead",
+			in:    strings.Repeat("a. IN A 192.0.2.1\n", 3) + "b. IN A 192.0.2.1\n",
+			opts:  []ScannerOption{WithReadAhead(8)},
+			names: "a.,a.,a.,b.",
+			data:  "192.0.2.1",
+		},
+		{
+			name:  "txt concatenation",
+			in:    "a. IN TXT ( \"v=spf1 \" \"-all\" )\n",
+			opts:  []ScannerOption{WithTXTConcatenation(true)},
+			names: "a.",
+			data:  "v=spf1 -all",
+		},
+		{
+			name:  "strict",
+			in:    "a. IN FOO\nb. 4294967295\nc. IN A 192.0.2.1\n",
+			so:    ScannerOptions{SkipUnknownTypes: true, StrictMode: true},
+			names: "c.",
+			data:  "192.0.2.1",
+			errs:  2,
+		},
+		{
+			name:  "max token size",
+			in:    "abcdefghijkl. IN A 192.0.2.1\nb. IN A 192.0.2.1\n",
+			so:    ScannerOptions{MaxTokenSize: 10},
+			names: "b.",
+			data:  "192.0.2.1",
+			errs:  1,
+		},
+		{
+			name:    "skip unknown types",
+			in:      "a. 1 IN FOO x y\nb. 1 IN A 192.0.2.1\nc. IN BAR z\n",
+			so:      ScannerOptions{SkipUnknownTypes: true, BufSize: 16},
+			names:   "b.",
+			data:    "192.0.2.1",
+			skipped: 2,
+		},
+		{
+			name:  "unknown types are errors",
+			in:    "a. 1 IN FOO\nb. 1 IN A 192.0.2.1\n",
+			names: "b.",
+			data:  "192.0.2.1",
+			errs:  1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewScannerWithOptions(strings.NewReader(tc.in), tc.so, tc.opts...)
+			defer s.Close()
+
+			var names []string
+			var data string
+			var errs int
+			var record Record
+			for i := 0; ; i++ {
+				if i == 100 {
+					t.Fatal("no io.EOF")
+				}
+				err := s.Next(&record)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					errs++
+					continue
+				}
+				if len(names) == 0 {
+					data = strings.Join(record.Data, "|")
+				}
+				names = append(names, record.DomainName)
+			}
+			if got := strings.Join(names, ","); got != tc.names || data != tc.data || errs != tc.errs {
+				t.Errorf("got %s (data %q) with %d errors, want %s (data %q) with %d", got, data, errs, tc.names, tc.data, tc.errs)
+			}
+			if stats := s.Stats(); stats.SkippedRecords != tc.skipped || stats.RecordsEmitted != uint64(len(names)) {
+				t.Errorf("stats %+v, want %d skipped and %d emitted", stats, tc.skipped, len(names))
+			}
+		})
+	}
+}
+
+func TestRecordIsOwnedBy(t *testing.T) {
+	record := Record{DomainName: "Example.", Type: RecordType_A, Data: []string{"192.0.2.1"}}
+	for apex, want := range map[string][2]bool{
+		"example":   {true, true},
+		"EXAMPLE.":  {true, true},
+		"":          {true, false},
+		"other.":    {false, false},
+		"ample.":    {false, false},
+		"x.example": {false, false},
+	} {
+		if record.IsOwnedBy(apex) != want[0] || record.IsApex(apex) != want[1] {
+			t.Errorf("%q: IsOwnedBy %t, IsApex %t; want %v", apex, record.IsOwnedBy(apex), record.IsApex(apex), want)
+		}
+	}
+}
+
+func TestScannerRun(t *testing.T) {
+	var names []string
+	s := NewScanner(strings.NewReader("a. IN A 192.0.2.1\nb. IN A 192.0.2.1\n"), WithRecordCallback(func(r Record) {
+		names = append(names, r.DomainName)
+	}))
+	if err := s.Run(context.Background()); err != nil || strings.Join(names, ",") != "a.,b." {
+		t.Errorf("got %v, %v", names, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = NewScanner(strings.NewReader("a. IN A 192.0.2.1\n"), WithRecordCallback(func(Record) {}))
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Errorf("cancelled Run = %v", err)
+	}
+	if err := NewScanner(strings.NewReader("")).Run(context.Background()); err == nil {
+		t.Error("Run without callback succeeded")
+	}
+}
+
+func TestRecordString(t *testing.T) {
+	for _, tc := range []struct {
+		record Record
+		want   string
+	}{
+		{
+			record: Record{DomainName: "a.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_A, Data: []string{"192.0.2.1"}},
+			want:   "a. 300 IN A 192.0.2.1",
+		},
+		{
+			record: Record{DomainName: "a.", TimeToLive: -1, Type: RecordType_TXT, Data: []string{`"v=spf1"`, "-all"}, Comment: "; spf"},
+			want:   `a. TXT "v=spf1" "-all" ; spf`,
+		},
+		{
+			record: Record{DomainName: "a.", TimeToLive: -1, Type: RecordType_SPF, Data: []string{`say "hi"`}},
+			want:   `a. SPF "say \"hi\""`,
+		},
+	} {
+		if got := tc.record.String(); got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestScannerPeek(t *testing.T) {
+	s := NewScanner(strings.NewReader("a. IN A 192.0.2.1\nb. IN A 192.0.2.2\n"))
+	var record Record
+	for _, want := range []string{"a.", "b."} {
+		p1, err1 := s.Peek()
+		p2, err2 := s.Peek()
+		if err1 != nil || err2 != nil || p1 != p2 || p1.DomainName != want {
+			t.Fatalf("Peek = %v, %v then %v, %v; want %s twice", p1, err1, p2, err2, want)
+		}
+		if err := s.Next(&record); err != nil || record.DomainName != want {
+			t.Fatalf("Next = %v, %v; want %s", record, err, want)
+		}
+	}
+	if _, err := s.Peek(); err != io.EOF {
+		t.Errorf("Peek at end = %v, want io.EOF", err)
+	}
+}
+
+func TestScannerSeekToSOA(t *testing.T) {
+	in := strings.Repeat("x. IN A 192.0.2.1\n", 100) + "a. IN SOA ns. host. 1 2 3 4 5\n" +
+		"y. IN A 192.0.2.1\nb. IN SOA ns. host. 6 2 3 4 5\n"
+	s := NewScanner(strings.NewReader(in))
+	for _, want := range []string{"a.", "b."} {
+		if soa, err := s.SeekToSOA(); err != nil || soa.DomainName != want {
+			t.Fatalf("SeekToSOA = %v, %v; want %s", soa, err, want)
+		}
+	}
+	if _, err := s.SeekToSOA(); err != io.EOF {
+		t.Errorf("SeekToSOA at end = %v, want io.EOF", err)
+	}
+}
+
+func TestIterRecords(t *testing.T) {
+	const in = "a. IN A 192.0.2.1\nb. IN FOO\nc. IN A 192.0.2.1\n"
+	fail := errors.New("fail")
+	for _, tc := range []struct {
+		name    string
+		fn      func(Record) error
+		err     error
+		records int
+		errs    int
+	}{
+		{name: "all", fn: func(Record) error { return nil }, records: 2, errs: 1},
+		{name: "stop", fn: func(Record) error { return ErrStop }, records: 1},
+		{name: "fail", fn: func(Record) error { return fail }, err: fail, records: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var records, errs int
+			err := IterRecords(strings.NewReader(in), func(r Record) error {
+				records++
+				return tc.fn(r)
+			}, WithErrorHandler(func(error) { errs++ }))
+			if err != tc.err || records != tc.records || errs != tc.errs {
+				t.Errorf("got %v with %d records and %d errors, want %v with %d and %d", err, records, errs, tc.err, tc.records, tc.errs)
+			}
+		})
+	}
+}
+
+func TestRecordClone(t *testing.T) {
+	record := Record{DomainName: "example.", Type: RecordType_MX, Data: []string{"10", "mail."}}
+	clone := record.Clone()
+	clone.Data[0] = "20"
+	if record.Data[0] != "10" {
+		t.Fatal("Clone shares Data")
+	}
+}
+
+func TestRecordEqual(t *testing.T) {
+	a := Record{DomainName: "Example.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_MX, Data: []string{"10", "mail."}, Comment: "; x"}
+	for _, tc := range []struct {
+		name      string
+		other     Record
+		equal     bool
+		dataEqual bool
+	}{
+		{name: "same", other: Record{DomainName: "example.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_MX, Data: []string{"10", "mail."}}, equal: true, dataEqual: true},
+		{name: "ttl", other: Record{DomainName: "example.", TimeToLive: 60, Class: RecordClass_IN, Type: RecordType_MX, Data: []string{"10", "mail."}}, dataEqual: true},
+		{name: "owner", other: Record{DomainName: "other.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_MX, Data: []string{"10", "mail."}}, dataEqual: true},
+		{name: "data", other: Record{DomainName: "example.", TimeToLive: 300, Class: RecordClass_IN, Type: RecordType_MX, Data: []string{"20", "mail."}}},
+	} {
+		if a.Equal(tc.other) != tc.equal || a.DataEqual(tc.other) != tc.dataEqual {
+			t.Errorf("%s: Equal %t, DataEqual %t", tc.name, a.Equal(tc.other), a.DataEqual(tc.other))
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	records, err := ParseBytes([]byte("a. IN A 192.0.2.1\nb. IN A 192.0.2.2\n"))
+	if err != nil || len(records) != 2 || records[1].DomainName != "b." {
+		t.Errorf("got %v, %v", records, err)
+	}
+	if _, err := ParseBytes([]byte("a. IN A 192.0.2.1\nb. IN A\n")); err == nil {
+		t.Error("ParseBytes ignored a parse error")
+	}
+}
+
+// syntheticZone returns a zone of n records of common types, the same for
+// every call.
+func syntheticZone(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	buf.WriteString("example. 3600 IN SOA ns1.example. hostmaster.example. ( 2024010101 7200 3600 1209600 3600 )\n")
+	for i := 1; i < n; i++ {
+		name := fmt.Sprintf("d%d-%x", i, rng.Uint32())
+		switch rng.Intn(4) {
+		case 0:
+			fmt.Fprintf(&buf, "%s 86400 IN NS ns%d.%s.example.\n", name, rng.Intn(4), name)
+		case 1:
+			fmt.Fprintf(&buf, "%s 300 IN A 192.0.%d.%d\n", name, rng.Intn(256), rng.Intn(256))
+		case 2:
+			fmt.Fprintf(&buf, "%s IN MX %d mail.%s ; backup\n", name, rng.Intn(50), name)
+		default:
+			fmt.Fprintf(&buf, "%s 3600 TXT \"v=spf1 ip4:192.0.2.%d -all\"\n", name, rng.Intn(256))
+		}
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkScanner measures the Scanner on a 100k-record zone. Run it with
+//
+//	go test ./zoneparse -run '^$' -bench=BenchmarkScanner -benchmem
+//
+// Baseline (Go 1.27, one Xeon core): about 1300 ns/record, 39 MB/s and 44 MB
+// allocated per op.
+func BenchmarkScanner(b *testing.B) {
+	const records = 100000
+	zone := syntheticZone(records)
+	b.SetBytes(int64(len(zone)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s := NewScanner(bytes.NewReader(zone))
+		var record Record
+		var n int
+		for s.Next(&record) == nil {
+			n++
+		}
+		if n != records {
+			b.Fatalf("read %d records, want %d", n, records)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*records), "ns/record")
+}